@@ -0,0 +1,272 @@
+// Command hclconfig validates and inspects HCL configuration files without
+// a Go struct to decode them into.
+//
+// Usage:
+//
+//	hclconfig validate [-var name=value] [-var-file file] FILE...
+//	hclconfig graph [-format dot|mermaid] [-var name=value] [-var-file file] FILE
+//	hclconfig eval [-var name=value] [-var-file file] FILE EXPR
+//	hclconfig fmt [-w] [-check] FILE...
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	hclconfig "github.com/bntso/hclconfig"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+)
+
+const usage = `Usage: hclconfig <command> [flags] [args]
+
+Commands:
+  validate FILE...   check syntax, references, cycles and var values
+  graph FILE         print the dependency graph as DOT or Mermaid
+  eval FILE EXPR     evaluate an expression against the resolved config
+  fmt FILE...        rewrite files in canonical HCL style
+
+Run "hclconfig <command> -h" for the flags of a command.
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run executes the command in args and returns the process exit code: 0 on
+// success, 1 when a file is invalid and 2 for usage errors.
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+	cmd, args := args[0], args[1:]
+	switch cmd {
+	case "validate":
+		return runValidate(args, stdout, stderr)
+	case "graph":
+		return runGraph(args, stdout, stderr)
+	case "eval":
+		return runEval(args, stdout, stderr)
+	case "fmt":
+		return runFmt(args, stdout, stderr)
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(stdout, usage)
+		return 0
+	}
+	fmt.Fprintf(stderr, "hclconfig: unknown command %q\n\n%s", cmd, usage)
+	return 2
+}
+
+// stringList is a repeatable string flag.
+type stringList []string
+
+func (l *stringList) String() string     { return strings.Join(*l, ", ") }
+func (l *stringList) Set(s string) error { *l = append(*l, s); return nil }
+
+// loadFlags are the flags shared by the commands that load a configuration.
+type loadFlags struct {
+	vars     stringList
+	varFiles stringList
+}
+
+func (f *loadFlags) register(fs *flag.FlagSet) {
+	fs.Var(&f.vars, "var", "set a var as `name=value` (repeatable)")
+	fs.Var(&f.varFiles, "var-file", "read var values from an .hclvars `file` (repeatable)")
+}
+
+func (f *loadFlags) options() []hclconfig.Option {
+	var opts []hclconfig.Option
+	for _, filename := range f.varFiles {
+		opts = append(opts, hclconfig.WithVarsFile(filename))
+	}
+	if len(f.vars) > 0 {
+		opts = append(opts, hclconfig.WithVarFlags(f.vars))
+	}
+	return opts
+}
+
+func newFlagSet(name, args string, stderr io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: hclconfig %s [flags] %s\n", name, args)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+func runValidate(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("validate", "FILE...", stderr)
+	var lf loadFlags
+	lf.register(fs)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	status := 0
+	for _, filename := range fs.Args() {
+		if err := hclconfig.ValidateFile(filename, lf.options()...); err != nil {
+			printError(stderr, err)
+			status = 1
+			continue
+		}
+		fmt.Fprintf(stdout, "%s: ok\n", filename)
+	}
+	return status
+}
+
+func runGraph(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("graph", "FILE", stderr)
+	format := fs.String("format", "dot", "output `format`: dot or mermaid")
+	var lf loadFlags
+	lf.register(fs)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	if *format != "dot" && *format != "mermaid" {
+		fmt.Fprintf(stderr, "hclconfig graph: unknown format %q\n", *format)
+		return 2
+	}
+
+	g, err := hclconfig.FileGraph(fs.Arg(0), lf.options()...)
+	if g == nil {
+		printError(stderr, err)
+		return 1
+	}
+	if *format == "mermaid" {
+		fmt.Fprint(stdout, g.Mermaid())
+	} else {
+		fmt.Fprint(stdout, g.DOT())
+	}
+	if err != nil {
+		printError(stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func runEval(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("eval", "FILE EXPR", stderr)
+	var lf loadFlags
+	lf.register(fs)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return 2
+	}
+
+	val, err := hclconfig.EvalFile(fs.Arg(0), fs.Arg(1), lf.options()...)
+	if err != nil {
+		printError(stderr, err)
+		return 1
+	}
+	fmt.Fprintln(stdout, formatValue(val))
+	return 0
+}
+
+// formatValue renders strings as they are and everything else in HCL syntax.
+func formatValue(val cty.Value) string {
+	if val.Type() == cty.String && val.IsKnown() && !val.IsNull() {
+		return val.AsString()
+	}
+	return string(hclwrite.TokensForValue(val).Bytes())
+}
+
+func runFmt(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("fmt", "FILE...", stderr)
+	write := fs.Bool("w", false, "write the result to the files instead of stdout")
+	check := fs.Bool("check", false, "list files that are not formatted and exit 1 if there are any")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	status := 0
+	for _, filename := range fs.Args() {
+		src, err := os.ReadFile(filename)
+		if err != nil {
+			fmt.Fprintf(stderr, "hclconfig fmt: %v\n", err)
+			status = 1
+			continue
+		}
+		if _, diags := hclparse.NewParser().ParseHCL(src, filename); diags.HasErrors() {
+			printError(stderr, &hclconfig.DiagnosticsError{Diags: diags})
+			status = 1
+			continue
+		}
+		formatted := hclwrite.Format(src)
+		switch {
+		case *check:
+			if !bytes.Equal(src, formatted) {
+				fmt.Fprintln(stdout, filename)
+				status = 1
+			}
+		case *write:
+			if bytes.Equal(src, formatted) {
+				continue
+			}
+			if err := os.WriteFile(filename, formatted, 0o644); err != nil {
+				fmt.Fprintf(stderr, "hclconfig fmt: %v\n", err)
+				status = 1
+			}
+		default:
+			stdout.Write(formatted)
+		}
+	}
+	return status
+}
+
+// printError prints err, rendering diagnostics with the source lines they
+// point at.
+func printError(w io.Writer, err error) {
+	var diagErr *hclconfig.DiagnosticsError
+	if !errors.As(err, &diagErr) {
+		fmt.Fprintf(w, "Error: %v\n", err)
+		return
+	}
+
+	// Parse every file the diagnostics mention so that the writer can show
+	// source snippets.
+	files := make(map[string]*hcl.File)
+	parser := hclparse.NewParser()
+	for _, diag := range diagErr.Diags {
+		if diag.Subject == nil {
+			continue
+		}
+		filename := diag.Subject.Filename
+		if _, ok := files[filename]; ok {
+			continue
+		}
+		src, err := os.ReadFile(filename)
+		if err != nil {
+			continue
+		}
+		if strings.HasSuffix(filename, ".json") {
+			files[filename], _ = parser.ParseJSON(src, filename)
+		} else {
+			files[filename], _ = parser.ParseHCL(src, filename)
+		}
+	}
+	hcl.NewDiagnosticTextWriter(w, files, 78, false).WriteDiagnostics(diagErr.Diags)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.hcl")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func runCommand(args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := run(args, &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestValidate(t *testing.T) {
+	path := writeConfig(t, `database {
+  host = missing
+}
+`)
+	code, _, stderr := runCommand("validate", path)
+	if code != 1 {
+		t.Errorf("exit code = %d, want 1", code)
+	}
+	if !strings.Contains(stderr, "2:   host = missing") {
+		t.Errorf("expected source snippet, got:\n%s", stderr)
+	}
+}
+
+func TestEval(t *testing.T) {
+	path := writeConfig(t, `var "port" {
+  default = 5432
+}
+database {
+  host = "localhost"
+  port = var.port
+}
+`)
+	code, stdout, stderr := runCommand("eval", "-var", "port=6543", path, "${database.host}:${database.port}")
+	if code != 0 {
+		t.Fatalf("exit code = %d: %s", code, stderr)
+	}
+	if stdout != "localhost:6543\n" {
+		t.Errorf("stdout = %q", stdout)
+	}
+}
+
+func TestGraph(t *testing.T) {
+	path := writeConfig(t, `database {
+  host = "localhost"
+}
+app {
+  url = database.host
+}
+`)
+	code, stdout, _ := runCommand("graph", "-format", "mermaid", path)
+	if code != 0 {
+		t.Fatalf("exit code = %d", code)
+	}
+	if !strings.Contains(stdout, `["app.url"]`) || !strings.Contains(stdout, "-->") {
+		t.Errorf("unexpected output:\n%s", stdout)
+	}
+}
+
+func TestFmt(t *testing.T) {
+	path := writeConfig(t, "a   = 1\nbb = 2\n")
+	if code, stdout, _ := runCommand("fmt", "-check", path); code != 1 || !strings.Contains(stdout, path) {
+		t.Errorf("fmt -check: exit code %d, stdout %q", code, stdout)
+	}
+	if code, _, stderr := runCommand("fmt", "-w", path); code != 0 {
+		t.Fatalf("fmt -w: exit code %d: %s", code, stderr)
+	}
+	got, _ := os.ReadFile(path)
+	if string(got) != "a  = 1\nbb = 2\n" {
+		t.Errorf("formatted = %q", got)
+	}
+}
+
+func TestUnknownCommand(t *testing.T) {
+	if code, _, _ := runCommand("frobnicate"); code != 2 {
+		t.Errorf("exit code = %d, want 2", code)
+	}
+}
@@ -0,0 +1,236 @@
+package hclconfig
+
+import (
+	"fmt"
+	"net/netip"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/hashicorp/hcl/v2"
+)
+
+// validateTag is the struct tag holding declarative constraints, checked
+// after the block holding the field has been decoded:
+//
+//	Port  int      `hcl:"port,attr" validate:"min=1,max=65535"`
+//	Mode  string   `hcl:"mode,attr" validate:"oneof=dev staging prod"`
+//	Name  string   `hcl:"name,attr" validate:"min=3,regex=^[a-z][a-z0-9-]*$"`
+//	Hosts []string `hcl:"hosts,attr" validate:"nonempty"`
+//
+// min, max and len bound numbers by value and strings, slices and maps by
+// length. oneof takes space-separated choices and regex takes the rest of the
+// tag, so it must come last. hostname, url, ip and cidr check string formats.
+// Rules apply to attributes the configuration sets, except nonempty, which
+// also rejects an omitted attribute.
+const validateTag = "validate"
+
+// constraint is a single rule of a validate tag.
+type constraint struct {
+	name string
+	arg  string
+}
+
+// parseConstraints splits a validate tag into its rules.
+func parseConstraints(tag string) []constraint {
+	var rules []constraint
+	for tag != "" {
+		var rule string
+		if strings.HasPrefix(tag, "regex=") {
+			rule, tag = tag, ""
+		} else {
+			rule, tag, _ = strings.Cut(tag, ",")
+		}
+		name, arg, _ := strings.Cut(strings.TrimSpace(rule), "=")
+		if name != "" {
+			rules = append(rules, constraint{name: name, arg: arg})
+		}
+	}
+	return rules
+}
+
+// checkConstraints checks the validate tags of the attribute fields of the
+// struct rv. Failures point at the attribute's expression in attrs, or at
+// fallback when a nonempty attribute was omitted.
+func checkConstraints(rv reflect.Value, attrs hcl.Attributes, fallback hcl.Range) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		tag, ok := field.Tag.Lookup(validateTag)
+		if !ok || field.Tag.Get("hcl") == "" {
+			continue
+		}
+		name, kind := parseHCLTag(field.Tag.Get("hcl"))
+		if kind != "attr" && kind != "optional" {
+			continue
+		}
+
+		subject := fallback
+		attr, present := attrs[name]
+		if present {
+			subject = attr.Expr.Range()
+		}
+		for _, rule := range parseConstraints(tag) {
+			if !present && rule.name != "nonempty" {
+				continue
+			}
+			problem, err := rule.check(rv.Field(i))
+			switch {
+			case err != nil:
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Invalid validate tag",
+					Detail:   fmt.Sprintf("The validate tag of field %s.%s is not valid: %s", rt.Name(), field.Name, err),
+					Subject:  subject.Ptr(),
+				})
+			case problem != "":
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Invalid value",
+					Detail:   fmt.Sprintf("The value of %q %s.", name, problem),
+					Subject:  subject.Ptr(),
+				})
+			}
+		}
+	}
+	return diags
+}
+
+// check applies the rule to fv. It returns a description of the problem if
+// the value breaks the rule, or an error if the rule itself is malformed.
+func (c constraint) check(fv reflect.Value) (string, error) {
+	for fv.Kind() == reflect.Ptr || fv.Kind() == reflect.Interface {
+		if fv.IsNil() {
+			return "", nil
+		}
+		fv = fv.Elem()
+	}
+
+	switch c.name {
+	case "min", "max", "len":
+		bound, err := strconv.ParseFloat(c.arg, 64)
+		if err != nil {
+			return "", fmt.Errorf("%s needs a number, got %q", c.name, c.arg)
+		}
+		val, isLength, ok := measure(fv)
+		if !ok {
+			return "", fmt.Errorf("%s does not apply to %s", c.name, fv.Type())
+		}
+		what := "must be"
+		if isLength {
+			what = "must have a length of"
+		}
+		arg := strconv.FormatFloat(bound, 'f', -1, 64)
+		switch {
+		case c.name == "min" && val < bound:
+			return fmt.Sprintf("%s at least %s", what, arg), nil
+		case c.name == "max" && val > bound:
+			return fmt.Sprintf("%s at most %s", what, arg), nil
+		case c.name == "len" && val != bound:
+			return fmt.Sprintf("%s exactly %s", what, arg), nil
+		}
+		return "", nil
+
+	case "nonempty":
+		switch fv.Kind() {
+		case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+			if fv.Len() == 0 {
+				return "must not be empty", nil
+			}
+			return "", nil
+		}
+		return "", fmt.Errorf("nonempty does not apply to %s", fv.Type())
+	}
+
+	if fv.Kind() != reflect.String {
+		return "", fmt.Errorf("%s only applies to strings", c.name)
+	}
+	s := fv.String()
+	switch c.name {
+	case "oneof":
+		choices := strings.Fields(c.arg)
+		for _, choice := range choices {
+			if s == choice {
+				return "", nil
+			}
+		}
+		return fmt.Sprintf("must be one of %s", strings.Join(choices, ", ")), nil
+	case "regex":
+		re, err := regexp.Compile(c.arg)
+		if err != nil {
+			return "", err
+		}
+		if !re.MatchString(s) {
+			return fmt.Sprintf("must match %s", c.arg), nil
+		}
+		return "", nil
+	}
+
+	check, ok := formatChecks[c.name]
+	if !ok {
+		return "", fmt.Errorf("unknown rule %q", c.name)
+	}
+	if !check.valid(s) {
+		return "must be " + check.description, nil
+	}
+	return "", nil
+}
+
+// measure returns the value of a number or the length of a string, slice or
+// map, reporting which of the two it is.
+func measure(fv reflect.Value) (val float64, isLength, ok bool) {
+	switch fv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(fv.Int()), false, true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(fv.Uint()), false, true
+	case reflect.Float32, reflect.Float64:
+		return fv.Float(), false, true
+	case reflect.String:
+		return float64(utf8.RuneCountInString(fv.String())), true, true
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return float64(fv.Len()), true, true
+	}
+	return 0, false, false
+}
+
+// formatCheck validates a string format.
+type formatCheck struct {
+	description string
+	valid       func(string) bool
+}
+
+var formatChecks = map[string]formatCheck{
+	"hostname": {"a valid hostname", validHostname},
+	"url": {"an absolute URL", func(s string) bool {
+		u, err := url.Parse(s)
+		return err == nil && u.Scheme != "" && u.Host != ""
+	}},
+	"ip": {"a valid IP address", func(s string) bool {
+		_, err := netip.ParseAddr(s)
+		return err == nil
+	}},
+	"cidr": {"a valid CIDR prefix", func(s string) bool {
+		_, err := netip.ParsePrefix(s)
+		return err == nil
+	}},
+}
+
+var hostnameLabel = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?$`)
+
+// validHostname reports whether s is a hostname as described in RFC 1123.
+func validHostname(s string) bool {
+	if len(s) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(s, ".") {
+		if !hostnameLabel.MatchString(label) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,135 @@
+package hclconfig
+
+import (
+	"strings"
+	"testing"
+)
+
+type ConstrainedServer struct {
+	Host    string   `hcl:"host,attr" validate:"hostname"`
+	Port    int      `hcl:"port,attr" validate:"min=1,max=65535"`
+	Mode    string   `hcl:"mode,optional" validate:"oneof=dev staging prod"`
+	Name    string   `hcl:"name,optional" validate:"min=3,regex=^[a-z][a-z0-9-]*$"`
+	URL     string   `hcl:"url,optional" validate:"url"`
+	Network string   `hcl:"network,optional" validate:"cidr"`
+	Peers   []string `hcl:"peers,optional" validate:"nonempty"`
+}
+
+type ConstrainedConfig struct {
+	Region  string              `hcl:"region,attr" validate:"len=2"`
+	Servers []ConstrainedServer `hcl:"server,block"`
+}
+
+func TestLoad_ValidateTags(t *testing.T) {
+	src := []byte(`
+region = "eu"
+server {
+    host    = "db-1.internal"
+    port    = 5432
+    mode    = "prod"
+    name    = "db-1"
+    url     = "https://db-1.internal/health"
+    network = "10.0.0.0/16"
+    peers   = ["db-2"]
+}
+`)
+	var cfg ConstrainedConfig
+	if err := Load(src, "test.hcl", &cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	src = []byte(`
+region = "europe"
+server {
+    host    = "-bad-"
+    port    = 70000
+    mode    = "test"
+    name    = "Db"
+    url     = "db-1.internal"
+    network = "10.0.0.0"
+    peers   = []
+}
+`)
+	err := Load(src, "test.hcl", &cfg)
+	if err == nil {
+		t.Fatal("expected validation errors")
+	}
+	msg := err.Error()
+	for _, want := range []string{
+		`test.hcl:4,15: Invalid value: In server block defined at test.hcl:4: The value of "host" must be a valid hostname.`,
+		`test.hcl:5,15: Invalid value: In server block defined at test.hcl:5: The value of "port" must be at most 65535.`,
+		`The value of "mode" must be one of dev, staging, prod.`,
+		`The value of "name" must have a length of at least 3.`,
+		`The value of "name" must match ^[a-z][a-z0-9-]*$.`,
+		`The value of "url" must be an absolute URL.`,
+		`The value of "network" must be a valid CIDR prefix.`,
+		`The value of "peers" must not be empty.`,
+	} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("expected %q in error, got:\n%s", want, msg)
+		}
+	}
+}
+
+func TestLoad_ValidateTagsOmitted(t *testing.T) {
+	// Only nonempty applies to omitted attributes.
+	src := []byte(`
+region = "eu"
+server {
+    host = "localhost"
+    port = 80
+}
+`)
+	var cfg ConstrainedConfig
+	err := Load(src, "test.hcl", &cfg)
+	if err == nil {
+		t.Fatal("expected validation error")
+	}
+	msg := err.Error()
+	if !strings.Contains(msg, `The value of "peers" must not be empty.`) {
+		t.Errorf("expected nonempty error, got:\n%s", msg)
+	}
+	if strings.Count(msg, "Invalid value") != 1 {
+		t.Errorf("unexpected error for omitted attribute:\n%s", msg)
+	}
+}
+
+func TestLoad_ValidateTagsTopLevel(t *testing.T) {
+	src := []byte(`
+region = "europe"
+server {
+    host  = "localhost"
+    port  = 80
+    peers = ["a"]
+}
+`)
+	var cfg ConstrainedConfig
+	err := Load(src, "test.hcl", &cfg)
+	want := `test.hcl:2,10: Invalid value: The value of "region" must have a length of exactly 2.`
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("expected %q, got: %v", want, err)
+	}
+}
+
+func TestLoad_ValidateTagsInvalidTag(t *testing.T) {
+	type config struct {
+		Port int `hcl:"port,attr" validate:"hostname"`
+	}
+	var cfg config
+	err := Load([]byte(`port = 80`), "test.hcl", &cfg)
+	if err == nil || !strings.Contains(err.Error(), "Invalid validate tag") {
+		t.Errorf("expected invalid tag error, got: %v", err)
+	}
+}
+
+func TestLoad_ValidateTagsTopLevelOmitted(t *testing.T) {
+	type config struct {
+		Peers []string `hcl:"peers,optional" validate:"nonempty"`
+	}
+	var cfg config
+	err := Load([]byte("\n"), "test.hcl", &cfg)
+	want := `test.hcl:1,1: Invalid value: The value of "peers" must not be empty.`
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("expected %q, got: %v", want, err)
+	}
+}
@@ -1,24 +1,47 @@
 package hclconfig
 
 import (
+	"fmt"
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/hashicorp/hcl/v2"
 	"github.com/zclconf/go-cty/cty"
 	"github.com/zclconf/go-cty/cty/function"
 )
 
-// newBaseEvalContext creates an EvalContext with the built-in env() function
-// and merges any user-supplied context.
-func newBaseEvalContext(userCtx *hcl.EvalContext) *hcl.EvalContext {
+// newBaseEvalContext creates an EvalContext with the built-in functions (the
+// env() and file() families and, unless disabled, the standard library) and
+// merges any user-supplied context.
+func newBaseEvalContext(o options) *hcl.EvalContext {
 	ctx := &hcl.EvalContext{
 		Variables: make(map[string]cty.Value),
 		Functions: map[string]function.Function{
-			"env": envFunction(),
+			"env":          envFunction(o.strictEnv),
+			"required_env": requiredEnvFunction(),
+			"env_int":      typedEnvFunction(cty.Number, parseEnvInt),
+			"env_bool":     typedEnvFunction(cty.Bool, parseEnvBool),
 		},
 	}
 
-	if userCtx != nil {
+	files := fileResolver{baseDir: o.baseDir, root: o.fileRoot, onRead: o.onRead}
+	ctx.Functions["file"] = fileFunction(files)
+	ctx.Functions["fileexists"] = fileExistsFunction(files)
+	ctx.Functions["templatefile"] = templateFileFunction(files, func() map[string]function.Function {
+		return ctx.Functions
+	})
+
+	if !o.noStdlib {
+		for name, fn := range stdlibFunctions() {
+			ctx.Functions[name] = fn
+		}
+	}
+	for name := range o.excludeFuncs {
+		delete(ctx.Functions, name)
+	}
+
+	if userCtx := o.evalCtx; userCtx != nil {
 		for k, v := range userCtx.Variables {
 			ctx.Variables[k] = v
 		}
@@ -30,7 +53,44 @@ func newBaseEvalContext(userCtx *hcl.EvalContext) *hcl.EvalContext {
 	return ctx
 }
 
-func envFunction() function.Function {
+// envFunction returns env(name[, default]), which reads an environment
+// variable. An unset variable yields the default if one is given, and
+// otherwise "" or, in strict mode, an error.
+func envFunction(strict bool) function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{
+				Name: "name",
+				Type: cty.String,
+			},
+		},
+		VarParam: &function.Parameter{
+			Name: "default",
+			Type: cty.String,
+		},
+		Type: function.StaticReturnType(cty.String),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			if len(args) > 2 {
+				return cty.NilVal, function.NewArgErrorf(2, "env takes at most one default value")
+			}
+			name := args[0].AsString()
+			if val, ok := os.LookupEnv(name); ok {
+				return cty.StringVal(val), nil
+			}
+			if len(args) == 2 {
+				return args[1], nil
+			}
+			if strict {
+				return cty.NilVal, fmt.Errorf("environment variable %s is not set", name)
+			}
+			return cty.StringVal(""), nil
+		},
+	})
+}
+
+// requiredEnvFunction returns required_env(name), which reads an environment
+// variable and fails when it is not set.
+func requiredEnvFunction() function.Function {
 	return function.New(&function.Spec{
 		Params: []function.Parameter{
 			{
@@ -41,7 +101,64 @@ func envFunction() function.Function {
 		Type: function.StaticReturnType(cty.String),
 		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
 			name := args[0].AsString()
-			return cty.StringVal(os.Getenv(name)), nil
+			val, ok := os.LookupEnv(name)
+			if !ok {
+				return cty.NilVal, fmt.Errorf("environment variable %s is not set", name)
+			}
+			return cty.StringVal(val), nil
+		},
+	})
+}
+
+// typedEnvFunction returns a function such as env_int(name[, default]) that
+// reads an environment variable and parses it into retType. An unset variable
+// yields the default, or an error when none is given.
+func typedEnvFunction(retType cty.Type, parse func(string) (cty.Value, error)) function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{
+				Name: "name",
+				Type: cty.String,
+			},
+		},
+		VarParam: &function.Parameter{
+			Name: "default",
+			Type: retType,
+		},
+		Type: function.StaticReturnType(retType),
+		Impl: func(args []cty.Value, _ cty.Type) (cty.Value, error) {
+			if len(args) > 2 {
+				return cty.NilVal, function.NewArgErrorf(2, "at most one default value is allowed")
+			}
+			name := args[0].AsString()
+			raw, ok := os.LookupEnv(name)
+			if !ok {
+				if len(args) == 2 {
+					return args[1], nil
+				}
+				return cty.NilVal, fmt.Errorf("environment variable %s is not set", name)
+			}
+			val, err := parse(raw)
+			if err != nil {
+				return cty.NilVal, fmt.Errorf("environment variable %s: %w", name, err)
+			}
+			return val, nil
 		},
 	})
 }
+
+func parseEnvInt(s string) (cty.Value, error) {
+	i, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil {
+		return cty.NilVal, fmt.Errorf("%q is not an integer", s)
+	}
+	return cty.NumberIntVal(i), nil
+}
+
+func parseEnvBool(s string) (cty.Value, error) {
+	b, err := strconv.ParseBool(strings.TrimSpace(s))
+	if err != nil {
+		return cty.NilVal, fmt.Errorf("%q is not a bool", s)
+	}
+	return cty.BoolVal(b), nil
+}
@@ -2,6 +2,7 @@ package hclconfig
 
 import (
 	"fmt"
+	"math/big"
 	"reflect"
 
 	"github.com/zclconf/go-cty/cty"
@@ -11,19 +12,43 @@ import (
 // suitable for use in an HCL EvalContext. This is necessary because gocty uses
 // `cty` struct tags, but consumer structs use `hcl` struct tags.
 func structToCtyValue(v interface{}) (cty.Value, error) {
-	return reflectToCtyValue(reflect.ValueOf(v))
+	return reflectToCtyValue(reflect.ValueOf(v), nil)
 }
 
-func reflectToCtyValue(rv reflect.Value) (cty.Value, error) {
+var ctyValueType = reflect.TypeOf(cty.Value{})
+
+func reflectToCtyValue(rv reflect.Value, encoders typeEncoders) (cty.Value, error) {
 	// Dereference pointers
 	for rv.Kind() == reflect.Ptr {
 		if rv.IsNil() {
 			return cty.NilVal, nil
 		}
+		if _, ok := encoders[rv.Type()]; ok {
+			break
+		}
 		rv = rv.Elem()
 	}
 
+	switch rv.Type() {
+	case ctyValueType:
+		return rv.Interface().(cty.Value), nil
+	case bigIntType:
+		bi := rv.Interface().(big.Int)
+		return cty.NumberVal(new(big.Float).SetInt(&bi)), nil
+	case bigFloatType:
+		bf := rv.Interface().(big.Float)
+		return cty.NumberVal(new(big.Float).Copy(&bf)), nil
+	}
+	if val, ok, err := encodeText(rv, encoders); ok {
+		return val, err
+	}
+
 	switch rv.Kind() {
+	case reflect.Interface:
+		if rv.IsNil() {
+			return cty.NullVal(cty.DynamicPseudoType), nil
+		}
+		return reflectToCtyValue(rv.Elem(), encoders)
 	case reflect.String:
 		return cty.StringVal(rv.String()), nil
 	case reflect.Bool:
@@ -35,17 +60,17 @@ func reflectToCtyValue(rv reflect.Value) (cty.Value, error) {
 	case reflect.Float32, reflect.Float64:
 		return cty.NumberFloatVal(rv.Float()), nil
 	case reflect.Struct:
-		return structFieldsToCtyObject(rv)
+		return structFieldsToCtyObject(rv, encoders)
 	case reflect.Slice:
-		return sliceToCtyValue(rv)
+		return sliceToCtyValue(rv, encoders)
 	case reflect.Map:
-		return mapToCtyValue(rv)
+		return mapToCtyValue(rv, encoders)
 	default:
 		return cty.NilVal, fmt.Errorf("unsupported kind %s", rv.Kind())
 	}
 }
 
-func structFieldsToCtyObject(rv reflect.Value) (cty.Value, error) {
+func structFieldsToCtyObject(rv reflect.Value, encoders typeEncoders) (cty.Value, error) {
 	rt := rv.Type()
 	attrs := make(map[string]cty.Value)
 
@@ -62,7 +87,12 @@ func structFieldsToCtyObject(rv reflect.Value) (cty.Value, error) {
 
 		switch kind {
 		case "attr", "optional":
-			val, err := reflectToCtyValue(fv)
+			// Captured expressions have no value of their own; the loader
+			// publishes the value they evaluate to, when it can.
+			if fv.Type() == exprType || fv.Type() == attrType {
+				continue
+			}
+			val, err := reflectToCtyValue(fv, encoders)
 			if err != nil {
 				return cty.NilVal, fmt.Errorf("field %s: %w", name, err)
 			}
@@ -71,7 +101,7 @@ func structFieldsToCtyObject(rv reflect.Value) (cty.Value, error) {
 			}
 
 		case "block":
-			val, err := blockFieldToCtyValue(fv)
+			val, err := blockFieldToCtyValue(fv, encoders)
 			if err != nil {
 				return cty.NilVal, fmt.Errorf("block %s: %w", name, err)
 			}
@@ -91,7 +121,7 @@ func structFieldsToCtyObject(rv reflect.Value) (cty.Value, error) {
 	return cty.ObjectVal(attrs), nil
 }
 
-func blockFieldToCtyValue(fv reflect.Value) (cty.Value, error) {
+func blockFieldToCtyValue(fv reflect.Value, encoders typeEncoders) (cty.Value, error) {
 	// Dereference pointer
 	for fv.Kind() == reflect.Ptr {
 		if fv.IsNil() {
@@ -105,9 +135,9 @@ func blockFieldToCtyValue(fv reflect.Value) (cty.Value, error) {
 		// Check if this is a labeled block by looking for a "label" tagged field
 		if hasLabelField(fv.Type()) {
 			// Single labeled block — wrap in map by label
-			return labeledBlockToMap(fv)
+			return labeledBlockToMap(fv, encoders)
 		}
-		return structFieldsToCtyObject(fv)
+		return structFieldsToCtyObject(fv, encoders)
 
 	case reflect.Slice:
 		// Slice of blocks
@@ -119,72 +149,86 @@ func blockFieldToCtyValue(fv reflect.Value) (cty.Value, error) {
 			elemType = elemType.Elem()
 		}
 		if elemType.Kind() == reflect.Struct && hasLabelField(elemType) {
-			return labeledBlockSliceToMap(fv)
+			return labeledBlockSliceToMap(fv, encoders)
 		}
-		return sliceToCtyValue(fv)
+		return sliceToCtyValue(fv, encoders)
 
 	default:
-		return reflectToCtyValue(fv)
+		return reflectToCtyValue(fv, encoders)
 	}
 }
 
-func labeledBlockToMap(rv reflect.Value) (cty.Value, error) {
-	label := getLabelValue(rv)
-	if label == "" {
-		return structFieldsToCtyObject(rv)
-	}
-	val, err := structFieldsToCtyObject(rv)
+func labeledBlockToMap(rv reflect.Value, encoders typeEncoders) (cty.Value, error) {
+	labels := labelValues(rv)
+	val, err := structFieldsToCtyObject(rv, encoders)
 	if err != nil {
 		return cty.NilVal, err
 	}
-	return cty.ObjectVal(map[string]cty.Value{label: val}), nil
+	if len(labels) == 0 || labels[0] == "" {
+		return val, nil
+	}
+	return labeledObject([][]string{labels}, []cty.Value{val}), nil
 }
 
-func labeledBlockSliceToMap(rv reflect.Value) (cty.Value, error) {
-	m := make(map[string]cty.Value)
+func labeledBlockSliceToMap(rv reflect.Value, encoders typeEncoders) (cty.Value, error) {
+	var labels [][]string
+	var vals []cty.Value
 	for i := 0; i < rv.Len(); i++ {
 		elem := rv.Index(i)
-		for elem.Kind() == reflect.Ptr {
+		if elem.Kind() == reflect.Ptr {
 			if elem.IsNil() {
 				continue
 			}
 			elem = elem.Elem()
 		}
-		label := getLabelValue(elem)
-		val, err := structFieldsToCtyObject(elem)
+		val, err := structFieldsToCtyObject(elem, encoders)
 		if err != nil {
 			return cty.NilVal, err
 		}
-		m[label] = val
+		labels = append(labels, labelValues(elem))
+		vals = append(vals, val)
 	}
-	if len(m) == 0 {
+	if len(vals) == 0 {
 		return cty.NilVal, nil
 	}
-	return cty.ObjectVal(m), nil
+	return labeledObject(labels, vals), nil
 }
 
-func hasLabelField(rt reflect.Type) bool {
-	for rt.Kind() == reflect.Ptr {
-		rt = rt.Elem()
+// labeledObject nests vals in objects keyed by their labels, one level per
+// label, so that a block labeled "aws_instance" "web" is found at
+// .aws_instance.web.
+func labeledObject(labels [][]string, vals []cty.Value) cty.Value {
+	var order []string
+	groups := make(map[string][]int)
+	for i, l := range labels {
+		if _, ok := groups[l[0]]; !ok {
+			order = append(order, l[0])
+		}
+		groups[l[0]] = append(groups[l[0]], i)
 	}
-	for i := 0; i < rt.NumField(); i++ {
-		tag := rt.Field(i).Tag.Get("hcl")
-		if tag == "" {
+
+	attrs := make(map[string]cty.Value, len(order))
+	for _, name := range order {
+		idx := groups[name]
+		if len(labels[idx[0]]) == 1 {
+			attrs[name] = vals[idx[0]]
 			continue
 		}
-		_, kind := parseHCLTag(tag)
-		if kind == "label" {
-			return true
+		rest := make([][]string, len(idx))
+		restVals := make([]cty.Value, len(idx))
+		for j, i := range idx {
+			rest[j] = labels[i][1:]
+			restVals[j] = vals[i]
 		}
+		attrs[name] = labeledObject(rest, restVals)
 	}
-	return false
+	return cty.ObjectVal(attrs)
 }
 
-func getLabelValue(rv reflect.Value) string {
-	for rv.Kind() == reflect.Ptr {
-		rv = rv.Elem()
+func hasLabelField(rt reflect.Type) bool {
+	for rt.Kind() == reflect.Ptr {
+		rt = rt.Elem()
 	}
-	rt := rv.Type()
 	for i := 0; i < rt.NumField(); i++ {
 		tag := rt.Field(i).Tag.Get("hcl")
 		if tag == "" {
@@ -192,19 +236,19 @@ func getLabelValue(rv reflect.Value) string {
 		}
 		_, kind := parseHCLTag(tag)
 		if kind == "label" {
-			return rv.Field(i).String()
+			return true
 		}
 	}
-	return ""
+	return false
 }
 
-func sliceToCtyValue(rv reflect.Value) (cty.Value, error) {
+func sliceToCtyValue(rv reflect.Value, encoders typeEncoders) (cty.Value, error) {
 	if rv.Len() == 0 {
 		return cty.EmptyTupleVal, nil
 	}
 	vals := make([]cty.Value, rv.Len())
 	for i := 0; i < rv.Len(); i++ {
-		v, err := reflectToCtyValue(rv.Index(i))
+		v, err := reflectToCtyValue(rv.Index(i), encoders)
 		if err != nil {
 			return cty.NilVal, err
 		}
@@ -213,13 +257,13 @@ func sliceToCtyValue(rv reflect.Value) (cty.Value, error) {
 	return cty.TupleVal(vals), nil
 }
 
-func mapToCtyValue(rv reflect.Value) (cty.Value, error) {
+func mapToCtyValue(rv reflect.Value, encoders typeEncoders) (cty.Value, error) {
 	if rv.Len() == 0 {
 		return cty.EmptyObjectVal, nil
 	}
 	attrs := make(map[string]cty.Value)
 	for _, key := range rv.MapKeys() {
-		v, err := reflectToCtyValue(rv.MapIndex(key))
+		v, err := reflectToCtyValue(rv.MapIndex(key), encoders)
 		if err != nil {
 			return cty.NilVal, err
 		}
@@ -76,7 +76,7 @@ func TestStructToCtyValue_LabeledBlock(t *testing.T) {
 
 	// Test labeled block wrapping via blockFieldToCtyValue
 	fv := reflect.ValueOf(Service{Name: "api", Host: "api.example.com", Port: 8080})
-	wrapped, err := blockFieldToCtyValue(fv)
+	wrapped, err := blockFieldToCtyValue(fv, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -0,0 +1,394 @@
+package hclconfig
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+	"github.com/zclconf/go-cty/cty/gocty"
+)
+
+var (
+	exprType     = reflect.TypeOf((*hcl.Expression)(nil)).Elem()
+	attrType     = reflect.TypeOf((*hcl.Attribute)(nil))
+	attrsType    = reflect.TypeOf(hcl.Attributes(nil))
+	bodyType     = reflect.TypeOf((*hcl.Body)(nil)).Elem()
+	bigIntType   = reflect.TypeOf(big.Int{})
+	bigFloatType = reflect.TypeOf(big.Float{})
+)
+
+// decodeBody decodes body into the struct rv the way gohcl.DecodeBody does,
+// but converts attribute values with setCtyValueOnField, so that block
+// attributes accept the same field types as top-level ones.
+func decodeBody(body hcl.Body, evalCtx *hcl.EvalContext, rv reflect.Value, decoders typeDecoders) hcl.Diagnostics {
+	schema, partial := gohcl.ImpliedBodySchema(rv.Addr().Interface())
+	var content *hcl.BodyContent
+	var leftovers hcl.Body
+	var diags hcl.Diagnostics
+	if partial {
+		content, leftovers, diags = body.PartialContent(schema)
+	} else {
+		content, diags = body.Content(schema)
+	}
+	if content == nil {
+		return diags
+	}
+	blocksByType := content.Blocks.ByType()
+
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		tag := rt.Field(i).Tag.Get("hcl")
+		if tag == "" {
+			continue
+		}
+		name, kind := parseHCLTag(tag)
+		fieldVal := rv.Field(i)
+		switch kind {
+		case "attr", "optional":
+			attr, ok := content.Attributes[name]
+			if !ok {
+				// As gohcl does, give omitted expression fields a null
+				// expression rather than leaving them nil.
+				if exprType.AssignableTo(fieldVal.Type()) {
+					synth := hcl.StaticExpr(cty.NullVal(cty.DynamicPseudoType), body.MissingItemRange())
+					fieldVal.Set(reflect.ValueOf(synth))
+				}
+				continue
+			}
+			_, attrDiags := decodeAttribute(attr, evalCtx, fieldVal, decoders)
+			diags = append(diags, attrDiags...)
+		case "block":
+			diags = append(diags, decodeBlockField(fieldVal, name, blocksByType[name], body, evalCtx, decoders)...)
+		case "body":
+			fieldVal.Set(reflect.ValueOf(body))
+		case "remain":
+			switch {
+			case bodyType.AssignableTo(fieldVal.Type()):
+				fieldVal.Set(reflect.ValueOf(leftovers))
+			case attrsType.AssignableTo(fieldVal.Type()):
+				attrs, attrsDiags := leftovers.JustAttributes()
+				diags = append(diags, attrsDiags...)
+				fieldVal.Set(reflect.ValueOf(attrs))
+			default:
+				diags = append(diags, decodeBody(leftovers, evalCtx, fieldVal, decoders)...)
+			}
+		}
+	}
+	return diags
+}
+
+// decodeBlockField decodes the nested blocks of type name into fieldVal,
+// which may be a struct, a pointer to a struct or a slice of either, and
+// applies the defaults of each block decoded. body is the body holding the
+// blocks, at which a missing block is reported.
+func decodeBlockField(fieldVal reflect.Value, name string, blocks []*hcl.Block, body hcl.Body, evalCtx *hcl.EvalContext, decoders typeDecoders) hcl.Diagnostics {
+	ft := fieldVal.Type()
+	isSlice := ft.Kind() == reflect.Slice
+	if isSlice {
+		ft = ft.Elem()
+	}
+	isPtr := ft.Kind() == reflect.Ptr
+	if isPtr {
+		ft = ft.Elem()
+	}
+
+	switch {
+	case len(blocks) > 1 && !isSlice:
+		return hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  fmt.Sprintf("Duplicate %s block", name),
+			Detail:   fmt.Sprintf("Only one %s block is allowed. Another was defined at %s.", name, blocks[0].DefRange),
+			Subject:  blocks[1].DefRange.Ptr(),
+		}}
+	case len(blocks) == 0 && (isSlice || isPtr):
+		fieldVal.Set(reflect.Zero(fieldVal.Type()))
+		return nil
+	case len(blocks) == 0:
+		return hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  fmt.Sprintf("Missing %s block", name),
+			Detail:   fmt.Sprintf("A %s block is required.", name),
+			Subject:  body.MissingItemRange().Ptr(),
+		}}
+	}
+
+	var diags hcl.Diagnostics
+	decodeElem := func(block *hcl.Block) reflect.Value {
+		elem := reflect.New(ft)
+		setLabelFields(elem.Elem(), block.Labels)
+		elemDiags := decodeBody(block.Body, evalCtx, elem.Elem(), decoders)
+		if !elemDiags.HasErrors() {
+			_, elemDiags = applyDefaults(elem.Elem(), block.Body, decoders)
+		}
+		diags = append(diags, elemDiags...)
+		if isPtr {
+			return elem
+		}
+		return elem.Elem()
+	}
+	if !isSlice {
+		fieldVal.Set(decodeElem(blocks[0]))
+		return diags
+	}
+	slice := reflect.MakeSlice(fieldVal.Type(), 0, len(blocks))
+	for _, block := range blocks {
+		slice = reflect.Append(slice, decodeElem(block))
+	}
+	fieldVal.Set(slice)
+	return diags
+}
+
+// decodeAttribute evaluates attr and sets fieldVal from its value, which it
+// returns. hcl.Expression and *hcl.Attribute fields capture the attribute
+// without evaluating it.
+func decodeAttribute(attr *hcl.Attribute, evalCtx *hcl.EvalContext, fieldVal reflect.Value, decoders typeDecoders) (cty.Value, hcl.Diagnostics) {
+	if t := fieldVal.Type(); t == exprType || t == attrType {
+		return cty.NilVal, setAttributeDiags(fieldVal, attr, cty.NilVal, decoders)
+	}
+	val, diags := attr.Expr.Value(evalCtx)
+	if diags.HasErrors() {
+		return val, diags
+	}
+	return val, setAttributeDiags(fieldVal, attr, val, decoders)
+}
+
+// setAttributeDiags is setAttributeField reporting failure as a diagnostic
+// that names the attribute and points at its expression.
+func setAttributeDiags(fieldVal reflect.Value, attr *hcl.Attribute, val cty.Value, decoders typeDecoders) hcl.Diagnostics {
+	if err := setAttributeField(fieldVal, attr, val, decoders); err != nil {
+		return hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  "Unsuitable value type",
+			Detail:   fmt.Sprintf("Attribute %q: %s", attr.Name, err),
+			Subject:  attr.Expr.Range().Ptr(),
+		}}
+	}
+	return nil
+}
+
+// setAttributeField sets an attribute field from attr, whose value is val.
+// hcl.Expression and *hcl.Attribute fields capture the attribute as written.
+func setAttributeField(fieldVal reflect.Value, attr *hcl.Attribute, val cty.Value, decoders typeDecoders) error {
+	switch fieldVal.Type() {
+	case exprType:
+		fieldVal.Set(reflect.ValueOf(attr.Expr))
+		return nil
+	case attrType:
+		fieldVal.Set(reflect.ValueOf(attr))
+		return nil
+	}
+	return setCtyValueOnField(fieldVal, val, decoders)
+}
+
+// setCtyValueOnField sets a struct field from a cty.Value. Types with a
+// decoder are set by it; pointers, slices, maps, interfaces and structs with
+// hcl tags are filled element by element, numbers are checked to fit the
+// field, and other types are converted by gocty, as gohcl does.
+func setCtyValueOnField(fieldVal reflect.Value, val cty.Value, decoders typeDecoders) error {
+	ft := fieldVal.Type()
+	if ft == ctyValueType {
+		fieldVal.Set(reflect.ValueOf(val))
+		return nil
+	}
+	if !val.IsKnown() {
+		return fmt.Errorf("value must be known")
+	}
+	if val.IsNull() {
+		switch ft.Kind() {
+		case reflect.Ptr, reflect.Interface, reflect.Slice, reflect.Map:
+			fieldVal.Set(reflect.Zero(ft))
+			return nil
+		}
+		return fmt.Errorf("null value is not allowed")
+	}
+	if dec, ok := decoders.lookup(ft); ok {
+		return decodeWith(dec, fieldVal, val)
+	}
+
+	switch ft.Kind() {
+	case reflect.Ptr:
+		ptr := reflect.New(ft.Elem())
+		if err := setCtyValueOnField(ptr.Elem(), val, decoders); err != nil {
+			return err
+		}
+		fieldVal.Set(ptr)
+		return nil
+	case reflect.Interface:
+		goVal := reflect.ValueOf(ctyToGo(val))
+		if !goVal.IsValid() || !goVal.Type().AssignableTo(ft) {
+			return fmt.Errorf("cannot assign %s to %s", val.Type().FriendlyName(), ft)
+		}
+		fieldVal.Set(goVal)
+		return nil
+	}
+
+	switch {
+	case isNumberType(ft):
+		return setNumber(fieldVal, val)
+	case ft.Kind() == reflect.Slice:
+		return setSliceFromCty(fieldVal, val, decoders)
+	case ft.Kind() == reflect.Map && ft.Key().Kind() == reflect.String:
+		return setMapFromCty(fieldVal, val, decoders)
+	case ft.Kind() == reflect.Struct && hasHCLTags(ft):
+		return setStructFromCty(fieldVal, val, decoders)
+	}
+
+	ty, err := gocty.ImpliedType(fieldVal.Addr().Interface())
+	if err != nil {
+		return fmt.Errorf("unsupported field type %s", ft)
+	}
+	val, err = convert.Convert(val, ty)
+	if err != nil {
+		return err
+	}
+	return gocty.FromCtyValue(val, fieldVal.Addr().Interface())
+}
+
+func setSliceFromCty(fieldVal reflect.Value, val cty.Value, decoders typeDecoders) error {
+	if !val.Type().IsListType() && !val.Type().IsTupleType() && !val.Type().IsSetType() {
+		return fmt.Errorf("cannot convert %s to slice", val.Type().FriendlyName())
+	}
+	elems := val.AsValueSlice()
+	slice := reflect.MakeSlice(fieldVal.Type(), len(elems), len(elems))
+	for i, elem := range elems {
+		if err := setCtyValueOnField(slice.Index(i), elem, decoders); err != nil {
+			return fmt.Errorf("element %d: %w", i, err)
+		}
+	}
+	fieldVal.Set(slice)
+	return nil
+}
+
+func setMapFromCty(fieldVal reflect.Value, val cty.Value, decoders typeDecoders) error {
+	if !val.Type().IsMapType() && !val.Type().IsObjectType() {
+		return fmt.Errorf("cannot convert %s to map", val.Type().FriendlyName())
+	}
+	ft := fieldVal.Type()
+	m := reflect.MakeMapWithSize(ft, val.LengthInt())
+	for it := val.ElementIterator(); it.Next(); {
+		key, elem := it.Element()
+		elemVal := reflect.New(ft.Elem()).Elem()
+		if err := setCtyValueOnField(elemVal, elem, decoders); err != nil {
+			return fmt.Errorf("element %q: %w", key.AsString(), err)
+		}
+		m.SetMapIndex(reflect.ValueOf(key.AsString()).Convert(ft.Key()), elemVal)
+	}
+	fieldVal.Set(m)
+	return nil
+}
+
+// setStructFromCty sets the attribute fields of a struct with hcl tags from
+// an object value.
+func setStructFromCty(fieldVal reflect.Value, val cty.Value, decoders typeDecoders) error {
+	if !val.Type().IsMapType() && !val.Type().IsObjectType() {
+		return fmt.Errorf("cannot convert %s to object", val.Type().FriendlyName())
+	}
+	ft := fieldVal.Type()
+	for i := 0; i < ft.NumField(); i++ {
+		tag := ft.Field(i).Tag.Get("hcl")
+		if tag == "" {
+			continue
+		}
+		name, kind := parseHCLTag(tag)
+		if kind != "attr" && kind != "optional" {
+			continue
+		}
+		var attrVal cty.Value
+		if val.Type().IsObjectType() {
+			if val.Type().HasAttribute(name) {
+				attrVal = val.GetAttr(name)
+			}
+		} else if elem := cty.StringVal(name); val.HasIndex(elem).True() {
+			attrVal = val.Index(elem)
+		}
+		if attrVal == cty.NilVal || attrVal.IsNull() {
+			if kind == "attr" {
+				return fmt.Errorf("attribute %q is required", name)
+			}
+			continue
+		}
+		if err := setCtyValueOnField(fieldVal.Field(i), attrVal, decoders); err != nil {
+			return fmt.Errorf("attribute %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// hasHCLTags reports whether any field of the struct type rt has an hcl tag.
+func hasHCLTags(rt reflect.Type) bool {
+	for i := 0; i < rt.NumField(); i++ {
+		if rt.Field(i).Tag.Get("hcl") != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// isNumberType reports whether values of type t are set by setNumber.
+func isNumberType(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return t == bigIntType || t == bigFloatType
+}
+
+// setNumber sets a numeric field from val. Integer fields only accept whole
+// numbers, and no field accepts a number outside the range of its type.
+func setNumber(fieldVal reflect.Value, val cty.Value) error {
+	num, err := convert.Convert(val, cty.Number)
+	if err != nil {
+		return err
+	}
+	bf := num.AsBigFloat()
+	ft := fieldVal.Type()
+	text := bf.Text('g', -1)
+
+	switch ft {
+	case bigFloatType:
+		fieldVal.Addr().Interface().(*big.Float).Set(bf)
+		return nil
+	case bigIntType:
+		if !bf.IsInt() {
+			return fmt.Errorf("%s is not a whole number", text)
+		}
+		bf.Int(fieldVal.Addr().Interface().(*big.Int))
+		return nil
+	}
+
+	switch ft.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if !bf.IsInt() {
+			return fmt.Errorf("%s is not a whole number", text)
+		}
+		i, acc := bf.Int64()
+		if acc != big.Exact || fieldVal.OverflowInt(i) {
+			bits := ft.Bits()
+			return fmt.Errorf("%s is out of range for %s (%d to %d)", text, ft, int64(-1)<<(bits-1), int64(1)<<(bits-1)-1)
+		}
+		fieldVal.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if !bf.IsInt() {
+			return fmt.Errorf("%s is not a whole number", text)
+		}
+		u, acc := bf.Uint64()
+		if acc != big.Exact || fieldVal.OverflowUint(u) {
+			return fmt.Errorf("%s is out of range for %s (0 to %d)", text, ft, uint64(math.MaxUint64)>>(64-ft.Bits()))
+		}
+		fieldVal.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, _ := bf.Float64()
+		if math.IsInf(f, 0) || fieldVal.OverflowFloat(f) {
+			return fmt.Errorf("%s is out of range for %s", text, ft)
+		}
+		fieldVal.SetFloat(f)
+	}
+	return nil
+}
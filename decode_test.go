@@ -0,0 +1,92 @@
+package hclconfig
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestLoad_NumericRange(t *testing.T) {
+	type server struct {
+		Port    uint16  `hcl:"port,attr"`
+		Workers uint    `hcl:"workers,attr"`
+		Retries int8    `hcl:"retries,attr"`
+		Ratio   float32 `hcl:"ratio,attr"`
+	}
+	type config struct {
+		Port    uint16  `hcl:"port,attr"`
+		Count   int     `hcl:"count,attr"`
+		Server  server  `hcl:"server,block"`
+		Weights []uint8 `hcl:"weights,optional"`
+	}
+	src := []byte(`
+port  = 70000
+count = 1.9
+server {
+    port    = 8080
+    workers = -1
+    retries = 128
+    ratio   = 1e40
+}
+weights = [1, 256]
+`)
+	var cfg config
+	err := Load(src, "test.hcl", &cfg)
+	if err == nil {
+		t.Fatal("expected range errors")
+	}
+	msg := err.Error()
+	for _, want := range []string{
+		`test.hcl:2,9: Unsuitable value type: Attribute "port": 70000 is out of range for uint16 (0 to 65535)`,
+		`test.hcl:3,9: Unsuitable value type: Attribute "count": 1.9 is not a whole number`,
+		`test.hcl:6,15: Unsuitable value type: In server block defined at test.hcl:6: Attribute "workers": -1 is out of range for uint (0 to 18446744073709551615)`,
+		`Attribute "retries": 128 is out of range for int8 (-128 to 127)`,
+		`Attribute "ratio": 1e+40 is out of range for float32`,
+		`test.hcl:10,11: Unsuitable value type: Attribute "weights": element 1: 256 is out of range for uint8 (0 to 255)`,
+	} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("expected %q in error, got:\n%s", want, msg)
+		}
+	}
+}
+
+func TestLoad_BigNumbers(t *testing.T) {
+	type ledger struct {
+		Balance big.Int    `hcl:"balance,attr"`
+		Rate    *big.Float `hcl:"rate,attr"`
+	}
+	type config struct {
+		Supply *big.Int `hcl:"supply,attr"`
+		Ledger ledger   `hcl:"ledger,block"`
+		Copy   string   `hcl:"copy,attr"`
+	}
+	src := []byte(`
+supply = 123456789012345678901234567890
+ledger {
+    balance = supply * 2
+    rate    = 0.000000000000000000001
+}
+copy = "${ledger.balance}"
+`)
+	var cfg config
+	if err := Load(src, "test.hcl", &cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := cfg.Supply.String(); got != "123456789012345678901234567890" {
+		t.Errorf("Supply = %s", got)
+	}
+	if got := cfg.Ledger.Balance.String(); got != "246913578024691357802469135780" {
+		t.Errorf("Balance = %s", got)
+	}
+	if cfg.Ledger.Rate == nil || cfg.Ledger.Rate.Text('g', 3) != "1e-21" {
+		t.Errorf("Rate = %v", cfg.Ledger.Rate)
+	}
+	if cfg.Copy != "246913578024691357802469135780" {
+		t.Errorf("Copy = %s", cfg.Copy)
+	}
+
+	err := Load([]byte("supply = 1.5\nledger {\n balance = 1\n rate = 1\n}\ncopy = \"\""), "test.hcl", &cfg)
+	if err == nil || !strings.Contains(err.Error(), `Attribute "supply": 1.5 is not a whole number`) {
+		t.Errorf("expected whole number error, got: %v", err)
+	}
+}
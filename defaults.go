@@ -0,0 +1,144 @@
+package hclconfig
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Struct tags recognized alongside hcl tags:
+//
+//	Port int    `hcl:"port,optional" default:"5432"`
+//	TLS  *TLS   `hcl:"tls,block" required:"true"`
+//
+// A default applies when the attribute is omitted from the configuration.
+// String fields and fields with a type decoder, such as time.Duration, take
+// the tag text as is; other fields parse it as an HCL expression, e.g.
+// "true" or `["a", "b"]`. required:"true" makes an optional attribute, or a
+// pointer or slice block field, mandatory.
+const (
+	defaultTag  = "default"
+	requiredTag = "required"
+)
+
+// applyDefaults sets the attribute fields of the struct rv that body omits
+// to their default tags and returns the HCL names of the fields it set.
+// Nested blocks get their defaults as they are decoded.
+func applyDefaults(rv reflect.Value, body hcl.Body, decoders typeDecoders) ([]string, hcl.Diagnostics) {
+	schema, _ := gohcl.ImpliedBodySchema(rv.Addr().Interface())
+	content, _, _ := body.PartialContent(schema)
+	if content == nil {
+		return nil, nil
+	}
+
+	var applied []string
+	var diags hcl.Diagnostics
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		tag := field.Tag.Get("hcl")
+		if tag == "" {
+			continue
+		}
+		name, kind := parseHCLTag(tag)
+		if kind != "attr" && kind != "optional" {
+			continue
+		}
+		text, ok := field.Tag.Lookup(defaultTag)
+		if !ok {
+			continue
+		}
+		if _, present := content.Attributes[name]; present {
+			continue
+		}
+		if err := setDefault(rv.Field(i), text, decoders); err != nil {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid default tag",
+				Detail:   fmt.Sprintf("The default %q of field %s.%s is not valid: %s", text, rt.Name(), field.Name, err),
+			})
+			continue
+		}
+		applied = append(applied, name)
+	}
+	return applied, diags
+}
+
+// setDefault sets fieldVal from the text of a default tag.
+func setDefault(fieldVal reflect.Value, text string, decoders typeDecoders) error {
+	base := fieldVal.Type()
+	for base.Kind() == reflect.Ptr {
+		if _, ok := decoders.lookup(base); ok {
+			break
+		}
+		base = base.Elem()
+	}
+	if _, ok := decoders.lookup(base); ok || base.Kind() == reflect.String {
+		return setCtyValueOnField(fieldVal, cty.StringVal(text), decoders)
+	}
+	expr, diags := hclsyntax.ParseExpression([]byte(text), "<default>", hcl.InitialPos)
+	if diags.HasErrors() {
+		return diags
+	}
+	val, diags := expr.Value(nil)
+	if diags.HasErrors() {
+		return diags
+	}
+	return setCtyValueOnField(fieldVal, val, decoders)
+}
+
+// checkRequired reports the fields of the struct type rt tagged
+// required:"true" that body omits, and does the same for the nested blocks
+// body does contain.
+func checkRequired(rt reflect.Type, body hcl.Body) hcl.Diagnostics {
+	schema, _ := gohcl.ImpliedBodySchema(reflect.New(rt).Interface())
+	content, _, _ := body.PartialContent(schema)
+	if content == nil {
+		return nil
+	}
+	blocksByType := content.Blocks.ByType()
+
+	var diags hcl.Diagnostics
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		tag := field.Tag.Get("hcl")
+		if tag == "" {
+			continue
+		}
+		name, kind := parseHCLTag(tag)
+		required := field.Tag.Get(requiredTag) == "true"
+		switch kind {
+		case "attr", "optional":
+			if _, present := content.Attributes[name]; required && !present {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Missing required argument",
+					Detail:   fmt.Sprintf("The argument %q is required, but no definition was found.", name),
+					Subject:  body.MissingItemRange().Ptr(),
+				})
+			}
+		case "block":
+			blocks := blocksByType[name]
+			if required && len(blocks) == 0 {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  fmt.Sprintf("Missing %s block", name),
+					Detail:   fmt.Sprintf("A %s block is required.", name),
+					Subject:  body.MissingItemRange().Ptr(),
+				})
+			}
+			elemType := field.Type
+			for elemType.Kind() == reflect.Ptr || elemType.Kind() == reflect.Slice {
+				elemType = elemType.Elem()
+			}
+			for _, block := range blocks {
+				diags = append(diags, checkRequired(elemType, block.Body)...)
+			}
+		}
+	}
+	return diags
+}
@@ -0,0 +1,158 @@
+package hclconfig
+
+import (
+	"strings"
+	"testing"
+)
+
+type DefaultsDBConfig struct {
+	Host    string   `hcl:"host,attr"`
+	Port    int      `hcl:"port,optional" default:"5432"`
+	SSLMode string   `hcl:"sslmode,optional" default:"require"`
+	Tags    []string `hcl:"tags,optional" default:"[\"primary\"]"`
+}
+
+type DefaultsPoolConfig struct {
+	Size int `hcl:"size,optional" default:"10"`
+}
+
+type DefaultsAppConfig struct {
+	DBUrl string              `hcl:"db_url,attr"`
+	Pool  *DefaultsPoolConfig `hcl:"pool,block"`
+}
+
+type DefaultsConfig struct {
+	Timeout  int               `hcl:"timeout,optional" default:"30"`
+	Database DefaultsDBConfig  `hcl:"database,block"`
+	App      DefaultsAppConfig `hcl:"app,block"`
+}
+
+func TestLoad_DefaultTags(t *testing.T) {
+	src := []byte(`
+app {
+    db_url = "postgres://${database.host}:${database.port}/?sslmode=${database.sslmode}&timeout=${timeout}"
+    pool {}
+}
+database {
+    host = "localhost"
+}
+`)
+	var cfg DefaultsConfig
+	if err := Load(src, "test.hcl", &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Database.Port != 5432 || cfg.Database.SSLMode != "require" || len(cfg.Database.Tags) != 1 {
+		t.Errorf("database = %+v", cfg.Database)
+	}
+	if cfg.Timeout != 30 {
+		t.Errorf("timeout = %d, want 30", cfg.Timeout)
+	}
+	if want := "postgres://localhost:5432/?sslmode=require&timeout=30"; cfg.App.DBUrl != want {
+		t.Errorf("db_url = %q, want %q", cfg.App.DBUrl, want)
+	}
+	if cfg.App.Pool == nil || cfg.App.Pool.Size != 10 {
+		t.Errorf("pool = %+v, want size 10", cfg.App.Pool)
+	}
+}
+
+func TestLoad_DefaultTagsExplicitValueWins(t *testing.T) {
+	src := []byte(`
+database {
+    host = "localhost"
+    port = 0
+}
+app {
+    db_url = "${database.port}"
+}
+`)
+	var cfg DefaultsConfig
+	if err := Load(src, "test.hcl", &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Database.Port != 0 || cfg.App.DBUrl != "0" {
+		t.Errorf("port = %d, db_url = %q; explicit value should override the default", cfg.Database.Port, cfg.App.DBUrl)
+	}
+}
+
+func TestLoad_InvalidDefaultTag(t *testing.T) {
+	type Config struct {
+		Port int `hcl:"port,optional" default:"not a number"`
+	}
+	var cfg Config
+	err := Load([]byte(""), "test.hcl", &cfg)
+	if err == nil || !strings.Contains(err.Error(), "Invalid default tag") {
+		t.Errorf("expected invalid default tag error, got: %v", err)
+	}
+}
+
+func TestLoad_RequiredTags(t *testing.T) {
+	type TLSConfig struct {
+		Cert string `hcl:"cert,optional" required:"true"`
+	}
+	type ServerConfig struct {
+		Name string     `hcl:"name,optional" required:"true"`
+		TLS  *TLSConfig `hcl:"tls,block" required:"true"`
+	}
+	type Config struct {
+		Servers []ServerConfig `hcl:"server,block"`
+	}
+	src := []byte(`
+server {
+    tls {}
+}
+server {
+    name = "b"
+}
+`)
+	var cfg Config
+	err := Load(src, "test.hcl", &cfg)
+	if err == nil {
+		t.Fatal("expected missing required field errors")
+	}
+	msg := err.Error()
+	for _, want := range []string{
+		`test.hcl:2,8: Missing required argument: The argument "name" is required`,
+		`test.hcl:3,9: Missing required argument: The argument "cert" is required`,
+		`test.hcl:5,8: Missing tls block: A tls block is required.`,
+	} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("expected %q in error, got:\n%s", want, msg)
+		}
+	}
+}
+
+func TestLoad_DefaultTagsDeeplyNested(t *testing.T) {
+	type Retry struct {
+		Attempts int `hcl:"attempts,optional" default:"3"`
+	}
+	type Client struct {
+		Retry Retry `hcl:"retry,block"`
+	}
+	type Service struct {
+		Client Client `hcl:"client,block"`
+	}
+	type Config struct {
+		Service  Service `hcl:"service,block"`
+		Attempts int     `hcl:"attempts,attr"`
+	}
+	src := []byte(`
+attempts = service.client.retry.attempts
+service {
+    client {
+        retry {}
+    }
+}
+`)
+	var cfg Config
+	if err := Load(src, "test.hcl", &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Attempts != 3 || cfg.Service.Client.Retry.Attempts != 3 {
+		t.Errorf("attempts = %d, %d; want 3", cfg.Attempts, cfg.Service.Client.Retry.Attempts)
+	}
+
+	err := Load([]byte("attempts = service.client.retry.attempts\nservice {\n    client {}\n}\n"), "test.hcl", &cfg)
+	if err == nil || !strings.Contains(err.Error(), "test.hcl:3,12: Missing retry block") {
+		t.Errorf("expected missing retry block error, got: %v", err)
+	}
+}
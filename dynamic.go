@@ -0,0 +1,205 @@
+package hclconfig
+
+import (
+	"fmt"
+	"math/big"
+	"os"
+	"reflect"
+	"sort"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// LoadDynamic loads HCL source without a destination struct, inferring the
+// schema from the source itself, and returns the resolved configuration as an
+// object. References resolve exactly as they do for Load. Labeled blocks
+// become objects keyed by label, repeated unlabeled blocks become tuples and
+// a single unlabeled block becomes an object. var and locals blocks are used
+// for resolution but left out of the result. HCL JSON source has no way to
+// tell blocks from attributes, so all of its properties are attributes.
+func LoadDynamic(src []byte, filename string, opts ...Option) (cty.Value, error) {
+	dst, err := loadDynamic(src, filename, opts, nil)
+	if err != nil {
+		return cty.NilVal, err
+	}
+	return structToCtyValue(dst.Interface())
+}
+
+// LoadDynamicFile reads filename and loads it as LoadDynamic does.
+func LoadDynamicFile(filename string, opts ...Option) (cty.Value, error) {
+	src, err := os.ReadFile(filename)
+	if err != nil {
+		return cty.NilVal, fmt.Errorf("reading %s: %w", filename, err)
+	}
+	return LoadDynamic(src, filename, opts...)
+}
+
+// LoadMap loads HCL source as LoadDynamic does and converts the result to
+// Go values: strings, bools, int64 for whole numbers that fit and float64
+// for other numbers, []any for lists, tuples and sets, map[string]any for
+// maps and objects, and nil for null.
+func LoadMap(src []byte, filename string, opts ...Option) (map[string]any, error) {
+	val, err := LoadDynamic(src, filename, opts...)
+	if err != nil {
+		return nil, err
+	}
+	m, _ := ctyToGo(val).(map[string]any)
+	if m == nil {
+		m = make(map[string]any)
+	}
+	return m, nil
+}
+
+// loadDynamicFile reads filename and loads it as loadDynamic does.
+func loadDynamicFile(filename string, opts []Option, insp *inspection) error {
+	src, err := os.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", filename, err)
+	}
+	_, err = loadDynamic(src, filename, opts, insp)
+	return err
+}
+
+// loadDynamic loads src into a value of a struct type derived from the source
+// itself, recording the internals of the load in insp if it is not nil.
+func loadDynamic(src []byte, filename string, opts []Option, insp *inspection) (reflect.Value, error) {
+	file, diags := parseSource(hclparse.NewParser(), src, filename, newOptions(opts).syntax)
+	if diags.HasErrors() {
+		return reflect.Value{}, &DiagnosticsError{Diags: diags}
+	}
+
+	dst := reflect.New(dynamicType([]hcl.Body{file.Body}, 0, true))
+	opts = append(append([]Option{}, opts...), func(o *options) {
+		o.inspect = insp
+	})
+	if err := Load(src, filename, dst.Interface(), opts...); err != nil {
+		return reflect.Value{}, err
+	}
+	return dst, nil
+}
+
+// dynamicType builds a struct type with hcl tags that every one of bodies
+// decodes into. Attributes decode into cty.Value fields and are optional
+// unless present in every body. Block types decode into slices when they are
+// labeled or repeated and into pointers otherwise. JSON bodies cannot tell
+// blocks from attributes without a schema, so everything in them is an
+// attribute. At top level the var and locals blocks are left out.
+func dynamicType(bodies []hcl.Body, labels int, topLevel bool) reflect.Type {
+	var fields []reflect.StructField
+	add := func(name, kind string, typ reflect.Type) {
+		fields = append(fields, reflect.StructField{
+			Name: fmt.Sprintf("F%d", len(fields)),
+			Type: typ,
+			Tag:  reflect.StructTag(fmt.Sprintf(`hcl:"%s,%s"`, name, kind)),
+		})
+	}
+	for i := 0; i < labels; i++ {
+		add(fmt.Sprintf("label%d", i), "label", reflect.TypeOf(""))
+	}
+
+	attrCount := make(map[string]int)
+	var blockTypes []string
+	blocksByType := make(map[string][]*hclsyntax.Block)
+	repeated := make(map[string]bool)
+	for _, body := range bodies {
+		var names []string
+		if syntaxBody, ok := body.(*hclsyntax.Body); ok {
+			for name := range syntaxBody.Attributes {
+				names = append(names, name)
+			}
+			perBody := make(map[string]int)
+			for _, block := range syntaxBody.Blocks {
+				if topLevel && (block.Type == "var" || block.Type == "locals") {
+					continue
+				}
+				if _, ok := blocksByType[block.Type]; !ok {
+					blockTypes = append(blockTypes, block.Type)
+				}
+				blocksByType[block.Type] = append(blocksByType[block.Type], block)
+				perBody[block.Type]++
+				if perBody[block.Type] > 1 || len(block.Labels) > 0 {
+					repeated[block.Type] = true
+				}
+			}
+		} else {
+			attrs, _ := body.JustAttributes()
+			for name := range attrs {
+				if !topLevel || (name != "var" && name != "locals") {
+					names = append(names, name)
+				}
+			}
+		}
+		for _, name := range names {
+			attrCount[name]++
+		}
+	}
+
+	attrNames := make([]string, 0, len(attrCount))
+	for name := range attrCount {
+		attrNames = append(attrNames, name)
+	}
+	sort.Strings(attrNames)
+	for _, name := range attrNames {
+		kind := "attr"
+		if attrCount[name] < len(bodies) {
+			kind = "optional"
+		}
+		add(name, kind, ctyValueType)
+	}
+
+	for _, typeName := range blockTypes {
+		blocks := blocksByType[typeName]
+		blockBodies := make([]hcl.Body, len(blocks))
+		for i, block := range blocks {
+			blockBodies[i] = block.Body
+		}
+		elem := dynamicType(blockBodies, len(blocks[0].Labels), false)
+		if repeated[typeName] {
+			add(typeName, "block", reflect.SliceOf(elem))
+		} else {
+			add(typeName, "block", reflect.PointerTo(elem))
+		}
+	}
+
+	return reflect.StructOf(fields)
+}
+
+// ctyToGo converts a known cty value to plain Go values as described for
+// LoadMap.
+func ctyToGo(val cty.Value) any {
+	if val.IsNull() || !val.IsKnown() {
+		return nil
+	}
+	ty := val.Type()
+	switch {
+	case ty == cty.String:
+		return val.AsString()
+	case ty == cty.Bool:
+		return val.True()
+	case ty == cty.Number:
+		bf := val.AsBigFloat()
+		if i, acc := bf.Int64(); acc == big.Exact {
+			return i
+		}
+		f, _ := bf.Float64()
+		return f
+	case ty.IsListType() || ty.IsTupleType() || ty.IsSetType():
+		list := make([]any, 0, val.LengthInt())
+		for it := val.ElementIterator(); it.Next(); {
+			_, elem := it.Element()
+			list = append(list, ctyToGo(elem))
+		}
+		return list
+	case ty.IsMapType() || ty.IsObjectType():
+		m := make(map[string]any, val.LengthInt())
+		for it := val.ElementIterator(); it.Next(); {
+			key, elem := it.Element()
+			m[key.AsString()] = ctyToGo(elem)
+		}
+		return m
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package hclconfig
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestLoadDynamic(t *testing.T) {
+	src := []byte(`
+var "port" {
+  default = 5432
+}
+timeout = 30
+database {
+  host = "localhost"
+  port = var.port
+}
+service "api" {
+  host = "api.local"
+  tls {
+    enabled = true
+  }
+}
+service "web" {
+  host = "web.local"
+}
+listener {
+  port = 80
+}
+listener {
+  port = 443
+}
+app {
+  db_url = "postgres://${database.host}:${database.port}"
+  ports  = [for l in listener : l.port]
+}
+`)
+	val, err := LoadDynamic(src, "test.hcl")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := val.GetAttr("app").GetAttr("db_url"); !got.RawEquals(cty.StringVal("postgres://localhost:5432")) {
+		t.Errorf("app.db_url = %#v", got)
+	}
+	if got := val.GetAttr("service").GetAttr("api").GetAttr("tls").GetAttr("enabled"); !got.RawEquals(cty.True) {
+		t.Errorf("service.api.tls.enabled = %#v", got)
+	}
+	if got := val.GetAttr("listener"); !got.Type().IsTupleType() || got.LengthInt() != 2 {
+		t.Errorf("listener = %#v, want a tuple of 2 blocks", got)
+	}
+	if got := val.GetAttr("timeout"); !got.RawEquals(cty.NumberIntVal(30)) {
+		t.Errorf("timeout = %#v", got)
+	}
+	if val.Type().HasAttribute("var") {
+		t.Error("var blocks should not be part of the result")
+	}
+}
+
+func TestLoadMap(t *testing.T) {
+	src := []byte(`
+database {
+  host = "localhost"
+  port = 5432
+}
+service "api" {
+  weight = 0.5
+}
+app {
+  db_url = "postgres://${database.host}:${database.port}"
+  tags   = ["a", "b"]
+  debug  = false
+}
+`)
+	m, err := LoadMap(src, "test.hcl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"database": map[string]any{"host": "localhost", "port": int64(5432)},
+		"service":  map[string]any{"api": map[string]any{"weight": 0.5}},
+		"app": map[string]any{
+			"db_url": "postgres://localhost:5432",
+			"tags":   []any{"a", "b"},
+			"debug":  false,
+		},
+	}
+	if !reflect.DeepEqual(m, want) {
+		t.Errorf("got %#v\nwant %#v", m, want)
+	}
+}
+
+func TestLoadDynamic_UnknownReference(t *testing.T) {
+	src := []byte(`
+app {
+  url = database.host
+}
+`)
+	if _, err := LoadDynamic(src, "test.hcl"); err == nil {
+		t.Fatal("expected error for reference to undefined block")
+	}
+}
@@ -0,0 +1,296 @@
+package hclconfig
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"slices"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// isExpressionField reports whether fields of type t capture an attribute as
+// written rather than its value.
+func isExpressionField(t reflect.Type) bool {
+	return t.Implements(exprType) || t == attrType
+}
+
+// Encode renders src, a struct or pointer to struct with hcl tags, as HCL
+// native syntax. It honors the same attr, optional, block and label tag kinds
+// used for decoding; optional attributes holding their zero value are left
+// out. Fields of type hcl.Expression or *hcl.Attribute have no value to render
+// and are skipped.
+// Of opts, only WithTypeEncoder applies.
+func Encode(src any, opts ...Option) ([]byte, error) {
+	rv, err := structValue(src)
+	if err != nil {
+		return nil, err
+	}
+	f := hclwrite.NewEmptyFile()
+	if err := encodeBody(f.Body(), rv, true, newOptions(opts).encoders); err != nil {
+		return nil, err
+	}
+	return f.Bytes(), nil
+}
+
+// Rewrite updates the HCL source src, as loaded from filename with opts, so
+// that it encodes v. Attributes whose decoded value already matches v keep
+// their original expressions, such as "${database.host}", along with comments
+// and formatting; other attributes are replaced with literal values. Blocks
+// missing from src are appended and blocks missing from v are removed.
+// Repeated blocks are matched by their labels, or by position when they have
+// none. A kept expression that refers to a changed attribute, and so would no
+// longer decode to v, is replaced with a literal too. Only native syntax can
+// be rewritten.
+func Rewrite(src []byte, filename string, v any, opts ...Option) ([]byte, error) {
+	rv, err := structValue(v)
+	if err != nil {
+		return nil, err
+	}
+	encoders := newOptions(opts).encoders
+
+	// Reload each rewrite until it decodes to v. Every pass after the first
+	// only replaces kept expressions with literals, so this ends once no
+	// kept expression depends on a changed value.
+	for {
+		loaded := reflect.New(rv.Type())
+		if err := Load(src, filename, loaded.Interface(), opts...); err != nil {
+			return nil, err
+		}
+		f, diags := hclwrite.ParseConfig(src, filename, hcl.InitialPos)
+		if diags.HasErrors() {
+			return nil, &DiagnosticsError{Diags: diags}
+		}
+		if err := rewriteBody(f.Body(), rv, loaded.Elem(), encoders); err != nil {
+			return nil, err
+		}
+		out := f.Bytes()
+		if bytes.Equal(out, src) {
+			return out, nil
+		}
+		src = out
+	}
+}
+
+// structValue dereferences v, which must be a struct or pointer to struct.
+func structValue(v any) (reflect.Value, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return reflect.Value{}, fmt.Errorf("cannot encode nil %T", v)
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return reflect.Value{}, fmt.Errorf("cannot encode %T: must be a struct or pointer to struct", v)
+	}
+	return rv, nil
+}
+
+// encodeBody writes the attributes and blocks of the struct rv to body.
+// separate puts a blank line before each block, and before an attribute that
+// follows a block, as is usual at top level.
+func encodeBody(body *hclwrite.Body, rv reflect.Value, separate bool, encoders typeEncoders) error {
+	afterBlock := false
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		tag := field.Tag.Get("hcl")
+		if tag == "" || tag == "-" {
+			continue
+		}
+		name, kind := parseHCLTag(tag)
+		fv := rv.Field(i)
+
+		switch kind {
+		case "attr", "optional":
+			if isExpressionField(field.Type) || (kind == "optional" && fv.IsZero()) {
+				continue
+			}
+			val, err := reflectToCtyValue(fv, encoders)
+			if err != nil {
+				return fmt.Errorf("field %s: %w", name, err)
+			}
+			if val != cty.NilVal {
+				if separate && afterBlock {
+					body.AppendNewline()
+					afterBlock = false
+				}
+				body.SetAttributeValue(name, val)
+			}
+
+		case "block":
+			for _, elem := range blockElems(fv) {
+				if separate && len(body.Attributes())+len(body.Blocks()) > 0 {
+					body.AppendNewline()
+				}
+				if err := appendBlock(body, name, elem, encoders); err != nil {
+					return err
+				}
+				afterBlock = true
+			}
+		}
+	}
+	return nil
+}
+
+// appendBlock appends a block of type name encoding the struct rv to body.
+func appendBlock(body *hclwrite.Body, name string, rv reflect.Value, encoders typeEncoders) error {
+	block := body.AppendNewBlock(name, labelValues(rv))
+	if err := encodeBody(block.Body(), rv, false, encoders); err != nil {
+		return fmt.Errorf("block %s: %w", name, err)
+	}
+	return nil
+}
+
+// rewriteBody updates body to encode the struct rv. loaded is the value body
+// decoded to, which tells which attributes still hold their original value.
+func rewriteBody(body *hclwrite.Body, rv, loaded reflect.Value, encoders typeEncoders) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		tag := field.Tag.Get("hcl")
+		if tag == "" || tag == "-" {
+			continue
+		}
+		name, kind := parseHCLTag(tag)
+		fv := rv.Field(i)
+
+		switch kind {
+		case "attr", "optional":
+			if isExpressionField(field.Type) {
+				continue
+			}
+			val, err := reflectToCtyValue(fv, encoders)
+			if err != nil {
+				return fmt.Errorf("field %s: %w", name, err)
+			}
+			exists := body.GetAttribute(name) != nil
+			if exists {
+				old, err := reflectToCtyValue(loaded.Field(i), encoders)
+				if err == nil && val.RawEquals(old) {
+					continue
+				}
+			}
+			switch {
+			case val == cty.NilVal || (kind == "optional" && fv.IsZero()):
+				if exists {
+					body.RemoveAttribute(name)
+				}
+			default:
+				body.SetAttributeValue(name, val)
+			}
+
+		case "block":
+			if err := rewriteBlocks(body, name, blockElems(fv), blockElems(loaded.Field(i)), encoders); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// rewriteBlocks updates the blocks of type name in body to encode elems.
+// loaded holds the values the existing blocks decoded to, in source order.
+func rewriteBlocks(body *hclwrite.Body, name string, elems, loaded []reflect.Value, encoders typeEncoders) error {
+	var existing []*hclwrite.Block
+	for _, block := range body.Blocks() {
+		if block.Type() == name {
+			existing = append(existing, block)
+		}
+	}
+
+	matched := make(map[*hclwrite.Block]bool)
+	var added []reflect.Value
+	for i, elem := range elems {
+		labels := labelValues(elem)
+		j := slices.IndexFunc(existing, func(block *hclwrite.Block) bool {
+			if matched[block] {
+				return false
+			}
+			if len(labels) == 0 {
+				return true
+			}
+			return slices.Equal(block.Labels(), labels)
+		})
+		if j < 0 || (len(labels) == 0 && j != i) {
+			added = append(added, elem)
+			continue
+		}
+		matched[existing[j]] = true
+		old := reflect.New(elem.Type()).Elem()
+		if j < len(loaded) {
+			old = loaded[j]
+		}
+		if err := rewriteBody(existing[j].Body(), elem, old, encoders); err != nil {
+			return fmt.Errorf("block %s: %w", name, err)
+		}
+	}
+	for _, block := range existing {
+		if !matched[block] {
+			body.RemoveBlock(block)
+		}
+	}
+	for _, elem := range added {
+		if needsSeparator(body) {
+			body.AppendNewline()
+		}
+		if err := appendBlock(body, name, elem, encoders); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// needsSeparator reports whether a block appended to body should be preceded
+// by a blank line: the body has content and does not already end with one,
+// as it may after a block has been removed.
+func needsSeparator(body *hclwrite.Body) bool {
+	tokens := body.BuildTokens(nil)
+	n := len(tokens)
+	if n == 0 {
+		return false
+	}
+	return n < 2 || tokens[n-1].Type != hclsyntax.TokenNewline || tokens[n-2].Type != hclsyntax.TokenNewline
+}
+
+// blockElems returns the struct values held by a block field, skipping nil
+// pointers.
+func blockElems(fv reflect.Value) []reflect.Value {
+	for fv.Kind() == reflect.Ptr {
+		if fv.IsNil() {
+			return nil
+		}
+		fv = fv.Elem()
+	}
+	if fv.Kind() != reflect.Slice {
+		return []reflect.Value{fv}
+	}
+	elems := make([]reflect.Value, 0, fv.Len())
+	for i := 0; i < fv.Len(); i++ {
+		elem := fv.Index(i)
+		for elem.Kind() == reflect.Ptr && !elem.IsNil() {
+			elem = elem.Elem()
+		}
+		if elem.Kind() == reflect.Struct {
+			elems = append(elems, elem)
+		}
+	}
+	return elems
+}
+
+// labelValues returns the values of the label fields of the struct rv, in
+// field order.
+func labelValues(rv reflect.Value) []string {
+	var labels []string
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		if _, kind := parseHCLTag(rt.Field(i).Tag.Get("hcl")); kind == "label" {
+			labels = append(labels, rv.Field(i).String())
+		}
+	}
+	return labels
+}
@@ -0,0 +1,249 @@
+package hclconfig
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/hcl/v2"
+)
+
+type EncodeConfig struct {
+	Name     string          `hcl:"name,attr"`
+	Debug    bool            `hcl:"debug,optional"`
+	Tags     []string        `hcl:"tags,optional"`
+	Database DatabaseConfig  `hcl:"database,block"`
+	Cache    *DatabaseConfig `hcl:"cache,block"`
+	Services []ServiceConfig `hcl:"service,block"`
+}
+
+func TestEncode(t *testing.T) {
+	cfg := EncodeConfig{
+		Name:     "app",
+		Database: DatabaseConfig{Host: "localhost", Port: 5432},
+		Services: []ServiceConfig{
+			{Name: "api", Host: "api.example.com", Port: 8080},
+			{Name: "web", Host: "web.example.com", Port: 80},
+		},
+	}
+	got, err := Encode(&cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `name = "app"
+
+database {
+  host = "localhost"
+  port = 5432
+}
+
+service "api" {
+  host = "api.example.com"
+  port = 8080
+}
+
+service "web" {
+  host = "web.example.com"
+  port = 80
+}
+`
+	if string(got) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestEncode_AttributesAfterBlocks(t *testing.T) {
+	type config struct {
+		Name     string         `hcl:"name,attr"`
+		Database DatabaseConfig `hcl:"database,block"`
+		Env      string         `hcl:"env,attr"`
+		Region   string         `hcl:"region,attr"`
+		App      AppConfig      `hcl:"app,block"`
+	}
+	cfg := config{
+		Name:     "app",
+		Database: DatabaseConfig{Host: "localhost", Port: 5432},
+		Env:      "prod",
+		Region:   "eu",
+		App:      AppConfig{DBUrl: "postgres://localhost"},
+	}
+	got, err := Encode(&cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `name = "app"
+
+database {
+  host = "localhost"
+  port = 5432
+}
+
+env    = "prod"
+region = "eu"
+
+app {
+  db_url = "postgres://localhost"
+}
+`
+	if string(got) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestEncode_RoundTrip(t *testing.T) {
+	cfg := EncodeConfig{
+		Name:     "app",
+		Debug:    true,
+		Tags:     []string{"a", "b"},
+		Database: DatabaseConfig{Host: "localhost", Port: 5432},
+		Cache:    &DatabaseConfig{Host: "cache", Port: 6379},
+		Services: []ServiceConfig{{Name: "api", Host: "api.example.com", Port: 8080}},
+	}
+	src, err := Encode(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded EncodeConfig
+	if err := Load(src, "encoded.hcl", &decoded); err != nil {
+		t.Fatalf("decoding encoded config: %v\n%s", err, src)
+	}
+	if decoded.Name != cfg.Name || !decoded.Debug || len(decoded.Tags) != 2 ||
+		decoded.Database != cfg.Database || decoded.Cache == nil || *decoded.Cache != *cfg.Cache ||
+		len(decoded.Services) != 1 || decoded.Services[0] != cfg.Services[0] {
+		t.Errorf("round trip mismatch: %+v", decoded)
+	}
+}
+
+func TestEncode_SkipsExpressionFields(t *testing.T) {
+	type config struct {
+		Name   string         `hcl:"name,attr"`
+		When   hcl.Expression `hcl:"when,attr"`
+		Action *hcl.Attribute `hcl:"action,attr"`
+	}
+	src := []byte(`
+name   = "app"
+when   = request.path == "/x"
+action = respond(request)
+`)
+	var cfg config
+	if err := Load(src, "test.hcl", &cfg); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Encode(&cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "name = \"app\"\n"; string(got) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	cfg.Name = "web"
+	got, err = Rewrite(src, "test.hcl", &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(got), "action = respond(request)") || !strings.Contains(string(got), `name   = "web"`) {
+		t.Errorf("expected expressions kept, got:\n%s", got)
+	}
+}
+
+func TestEncode_NotStruct(t *testing.T) {
+	if _, err := Encode("nope"); err == nil {
+		t.Fatal("expected error for non-struct value")
+	}
+}
+
+func TestRewrite_PreservesExpressions(t *testing.T) {
+	src := []byte(`# Database settings
+database {
+  host = "localhost"
+  port = 5432
+}
+
+app {
+  db_url = "postgres://${database.host}:${database.port}/mydb"
+}
+`)
+	var cfg CrossRefConfig
+	if err := Load(src, "test.hcl", &cfg); err != nil {
+		t.Fatal(err)
+	}
+	cfg.Database.Port = 6543
+
+	got, err := Rewrite(src, "test.hcl", &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := string(got)
+	if !strings.Contains(out, "# Database settings") {
+		t.Errorf("comment lost:\n%s", out)
+	}
+	if !strings.Contains(out, "port = 6543") {
+		t.Errorf("changed attribute not rewritten:\n%s", out)
+	}
+	// Kept as is, the db_url expression would now interpolate the new port.
+	if !strings.Contains(out, `db_url = "postgres://localhost:5432/mydb"`) {
+		t.Errorf("expression depending on a changed value not replaced:\n%s", out)
+	}
+	var decoded CrossRefConfig
+	if err := Load(got, "test.hcl", &decoded); err != nil || decoded != cfg {
+		t.Errorf("rewritten config decodes to %+v, %v", decoded, err)
+	}
+}
+
+func TestRewrite_KeepsUnaffectedExpressions(t *testing.T) {
+	src := []byte(`database {
+  host = "localhost"
+  port = 5432
+}
+
+app {
+  db_url = "postgres://${database.host}/mydb"
+}
+`)
+	var cfg CrossRefConfig
+	if err := Load(src, "test.hcl", &cfg); err != nil {
+		t.Fatal(err)
+	}
+	cfg.Database.Port = 6543
+	got, err := Rewrite(src, "test.hcl", &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(got), `db_url = "postgres://${database.host}/mydb"`) {
+		t.Errorf("expression not preserved:\n%s", got)
+	}
+}
+
+func TestRewrite_Blocks(t *testing.T) {
+	src := []byte(`service "api" {
+  host = "api.example.com"
+  port = 8080
+}
+
+service "old" {
+  host = "old.example.com"
+  port = 81
+}
+`)
+	type Config struct {
+		Services []ServiceConfig `hcl:"service,block"`
+	}
+	cfg := Config{Services: []ServiceConfig{
+		{Name: "api", Host: "api.example.com", Port: 8080},
+		{Name: "new", Host: "new.example.com", Port: 82},
+	}}
+	got, err := Rewrite(src, "test.hcl", &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Config
+	if err := Load(got, "test.hcl", &decoded); err != nil {
+		t.Fatalf("decoding rewritten config: %v\n%s", err, got)
+	}
+	if len(decoded.Services) != 2 || decoded.Services[0] != cfg.Services[0] || decoded.Services[1] != cfg.Services[1] {
+		t.Errorf("services = %+v\n%s", decoded.Services, got)
+	}
+	if strings.Contains(string(got), "old") {
+		t.Errorf("removed block still present:\n%s", got)
+	}
+}
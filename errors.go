@@ -1,13 +1,15 @@
 package hclconfig
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 
 	"github.com/hashicorp/hcl/v2"
 )
 
-// CycleError is returned when circular dependencies are detected between blocks.
+// CycleError is returned when circular dependencies are detected. Cycle lists
+// the attribute paths involved, e.g. ["a.x", "b.y", "a.x"].
 type CycleError struct {
 	Cycle []string
 }
@@ -37,3 +39,16 @@ func (e *DiagnosticsError) Error() string {
 	}
 	return strings.Join(msgs, "\n")
 }
+
+// errorDiags converts err into diagnostics so that it can be reported along
+// with other failures in a single DiagnosticsError.
+func errorDiags(err error) hcl.Diagnostics {
+	var diagErr *DiagnosticsError
+	if errors.As(err, &diagErr) {
+		return diagErr.Diags
+	}
+	return hcl.Diagnostics{{
+		Severity: hcl.DiagError,
+		Summary:  err.Error(),
+	}}
+}
@@ -0,0 +1,210 @@
+package hclconfig
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+// WithFileRoot restricts file(), fileexists() and templatefile() to files
+// inside root. Paths that resolve outside it, including through symlinks,
+// are rejected.
+func WithFileRoot(root string) Option {
+	return func(o *options) {
+		o.fileRoot = root
+	}
+}
+
+// fileResolver turns paths given to the file functions into paths on disk.
+type fileResolver struct {
+	baseDir string            // directory relative paths are resolved against
+	root    string            // if set, every resolved path must be inside it
+	onRead  func(path string) // if set, called with every path looked at
+}
+
+// resolve returns the cleaned path for p, relative to baseDir unless it is
+// absolute, and enforces the root if there is one.
+func (r fileResolver) resolve(p string) (string, error) {
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(r.baseDir, p)
+	}
+	p = filepath.Clean(p)
+	if r.root == "" {
+		return r.track(p), nil
+	}
+
+	root, err := filepath.Abs(r.root)
+	if err != nil {
+		return "", err
+	}
+	if real, err := filepath.EvalSymlinks(root); err == nil {
+		root = real
+	}
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return "", err
+	}
+	if real, err := filepath.EvalSymlinks(abs); err == nil {
+		abs = real
+	}
+	rel, err := filepath.Rel(root, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside the allowed root %s", p, r.root)
+	}
+	return r.track(p), nil
+}
+
+// track reports p to onRead, if set, and returns it unchanged.
+func (r fileResolver) track(p string) string {
+	if r.onRead != nil {
+		r.onRead(p)
+	}
+	return p
+}
+
+// read returns the contents of the file at p, which must be valid UTF-8.
+func (r fileResolver) read(p string) (string, error) {
+	resolved, err := r.resolve(p)
+	if err != nil {
+		return "", err
+	}
+	src, err := os.ReadFile(resolved)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", fmt.Errorf("no file exists at %s", resolved)
+		}
+		return "", fmt.Errorf("reading %s: %w", resolved, err)
+	}
+	if !utf8.Valid(src) {
+		return "", fmt.Errorf("contents of %s are not valid UTF-8", resolved)
+	}
+	return string(src), nil
+}
+
+// fileFunction returns file(path), which reads a file as a string.
+func fileFunction(r fileResolver) function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{
+				Name: "path",
+				Type: cty.String,
+			},
+		},
+		Type: function.StaticReturnType(cty.String),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			src, err := r.read(args[0].AsString())
+			if err != nil {
+				return cty.NilVal, function.NewArgError(0, err)
+			}
+			return cty.StringVal(src), nil
+		},
+	})
+}
+
+// fileExistsFunction returns fileexists(path), which reports whether a
+// regular file exists at path.
+func fileExistsFunction(r fileResolver) function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{
+				Name: "path",
+				Type: cty.String,
+			},
+		},
+		Type: function.StaticReturnType(cty.Bool),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			resolved, err := r.resolve(args[0].AsString())
+			if err != nil {
+				return cty.NilVal, function.NewArgError(0, err)
+			}
+			info, err := os.Stat(resolved)
+			if errors.Is(err, fs.ErrNotExist) {
+				return cty.False, nil
+			}
+			if err != nil {
+				return cty.NilVal, function.NewArgError(0, err)
+			}
+			if !info.Mode().IsRegular() {
+				return cty.NilVal, function.NewArgErrorf(0, "%s is not a regular file", resolved)
+			}
+			return cty.True, nil
+		},
+	})
+}
+
+// templateFileFunction returns templatefile(path, vars), which renders a file
+// as an HCL template with vars in scope. funcs supplies the functions
+// available to the template; templatefile itself is excluded so templates
+// cannot recurse.
+func templateFileFunction(r fileResolver, funcs func() map[string]function.Function) function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{
+				Name: "path",
+				Type: cty.String,
+			},
+			{
+				Name: "vars",
+				Type: cty.DynamicPseudoType,
+			},
+		},
+		Type: function.StaticReturnType(cty.String),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			path := args[0].AsString()
+			src, err := r.read(path)
+			if err != nil {
+				return cty.NilVal, function.NewArgError(0, err)
+			}
+
+			varsVal := args[1]
+			if !varsVal.Type().IsObjectType() && !varsVal.Type().IsMapType() {
+				return cty.NilVal, function.NewArgErrorf(1, "invalid vars value: must be a map or object")
+			}
+			vars := make(map[string]cty.Value)
+			if !varsVal.IsNull() {
+				for it := varsVal.ElementIterator(); it.Next(); {
+					k, v := it.Element()
+					name := k.AsString()
+					if !hclsyntax.ValidIdentifier(name) {
+						return cty.NilVal, function.NewArgErrorf(1, "invalid template variable name %q: must start with a letter, followed by zero or more letters, digits, and underscores", name)
+					}
+					vars[name] = v
+				}
+			}
+
+			expr, diags := hclsyntax.ParseTemplate([]byte(src), path, hcl.InitialPos)
+			if diags.HasErrors() {
+				return cty.NilVal, function.NewArgError(0, diags)
+			}
+
+			templateFuncs := make(map[string]function.Function)
+			for name, fn := range funcs() {
+				if name != "templatefile" {
+					templateFuncs[name] = fn
+				}
+			}
+			val, diags := expr.Value(&hcl.EvalContext{
+				Variables: vars,
+				Functions: templateFuncs,
+			})
+			if diags.HasErrors() {
+				return cty.NilVal, function.NewArgError(0, diags)
+			}
+			val, err = convert.Convert(val, cty.String)
+			if err != nil || val.IsNull() {
+				return cty.NilVal, function.NewArgErrorf(0, "template result must be a string")
+			}
+			return val, nil
+		},
+	})
+}
@@ -0,0 +1,88 @@
+package hclconfig
+
+import (
+	"strings"
+	"testing"
+)
+
+type TLSFilesConfig struct {
+	TLS struct {
+		Cert     string `hcl:"cert,attr"`
+		HasKey   bool   `hcl:"has_key,attr"`
+		Greeting string `hcl:"greeting,attr"`
+	} `hcl:"tls,block"`
+}
+
+func TestLoadFile_FileFunctions(t *testing.T) {
+	// Paths in testdata/files/config.hcl are relative to that file, not to
+	// the working directory.
+	var cfg TLSFilesConfig
+	err := LoadFile("testdata/files/config.hcl", &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(cfg.TLS.Cert, "-----BEGIN CERTIFICATE-----") {
+		t.Errorf("cert = %q, want the contents of cert.pem", cfg.TLS.Cert)
+	}
+	if cfg.TLS.HasKey {
+		t.Error("expected has_key to be false")
+	}
+	expected := "Hello, OPS! You have 3 messages."
+	if cfg.TLS.Greeting != expected {
+		t.Errorf("greeting = %q, want %q", cfg.TLS.Greeting, expected)
+	}
+}
+
+func TestLoad_FileMissing(t *testing.T) {
+	src := []byte(`
+database {
+    host = file("missing.txt")
+    port = 5432
+}
+`)
+	var cfg SimpleConfig
+	err := Load(src, "testdata/files/missing.hcl", &cfg)
+	if err == nil {
+		t.Fatal("expected error for missing file")
+	}
+	if !strings.Contains(err.Error(), "no file exists") || !strings.Contains(err.Error(), "missing.hcl:3,") {
+		t.Errorf("expected missing file error at the call site, got: %v", err)
+	}
+}
+
+func TestLoad_WithFileRoot(t *testing.T) {
+	src := []byte(`
+database {
+    host = file("../simple.hcl")
+    port = 5432
+}
+`)
+	var cfg SimpleConfig
+	if err := Load(src, "testdata/files/root.hcl", &cfg); err != nil {
+		t.Fatalf("reads outside the config directory should be allowed without a root: %v", err)
+	}
+	err := Load(src, "testdata/files/root.hcl", &cfg, WithFileRoot("testdata/files"))
+	if err == nil {
+		t.Fatal("expected error for a path outside the root")
+	}
+	if !strings.Contains(err.Error(), "outside the allowed root") {
+		t.Errorf("expected root violation error, got: %v", err)
+	}
+}
+
+func TestLoad_TemplateFileUndefinedVar(t *testing.T) {
+	src := []byte(`
+database {
+    host = templatefile("greeting.tpl", { name = "x" })
+    port = 5432
+}
+`)
+	var cfg SimpleConfig
+	err := Load(src, "testdata/files/tpl.hcl", &cfg)
+	if err == nil {
+		t.Fatal("expected error for template variable that was not supplied")
+	}
+	if !strings.Contains(err.Error(), "count") {
+		t.Errorf("expected error naming the missing variable, got: %v", err)
+	}
+}
@@ -0,0 +1,139 @@
+package hclconfig
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+type FuncValuesConfig struct {
+	Values map[string]string `hcl:"values,attr"`
+}
+
+type FuncTestConfig struct {
+	Block FuncValuesConfig `hcl:"block,block"`
+}
+
+func TestLoad_StdlibFunctions(t *testing.T) {
+	src := []byte(`
+block {
+  values = {
+    upper     = upper("abc")
+    join      = join(",", split(" ", "a b c"))
+    format    = format("%s:%d", "host", 80)
+    replace   = replace("a-b-c", "-", "_")
+    regex     = replace("a1b22c", "/[0-9]+/", "")
+    merge     = jsonencode(merge({a = 1}, {b = 2}))
+    coalesce  = coalesce(null, "fallback")
+    lookup    = lookup({a = "x"}, "b", "default")
+    length    = tostring(length("héllo") + length([1, 2]))
+    number    = tostring(tonumber("42") + 1)
+    base64    = base64encode("hello")
+    decoded   = base64decode("aGVsbG8=")
+    concat    = join("", concat(["a"], ["b"]))
+    try       = try(tonumber("nope"), "fallback")
+  }
+}
+`)
+	var cfg FuncTestConfig
+	err := Load(src, "test.hcl", &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"upper":    "ABC",
+		"join":     "a,b,c",
+		"format":   "host:80",
+		"replace":  "a_b_c",
+		"regex":    "abc",
+		"merge":    `{"a":1,"b":2}`,
+		"coalesce": "fallback",
+		"lookup":   "default",
+		"length":   "7",
+		"number":   "43",
+		"base64":   "aGVsbG8=",
+		"decoded":  "hello",
+		"concat":   "ab",
+		"try":      "fallback",
+	}
+	for name, want := range expected {
+		if got := cfg.Block.Values[name]; got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestLoad_WithoutFunctions(t *testing.T) {
+	src := []byte(`
+database {
+    host = upper("localhost")
+    port = 5432
+}
+`)
+	var cfg SimpleConfig
+	err := Load(src, "test.hcl", &cfg, WithoutFunctions("upper"))
+	if err == nil {
+		t.Fatal("expected error for excluded function")
+	}
+	if !strings.Contains(err.Error(), "upper") {
+		t.Errorf("expected error naming the excluded function, got: %v", err)
+	}
+}
+
+func TestLoad_WithoutStdlib(t *testing.T) {
+	src := []byte(`
+database {
+    host = lower(env("HOME"))
+    port = 5432
+}
+`)
+	var cfg SimpleConfig
+	err := Load(src, "test.hcl", &cfg, WithoutStdlib())
+	if err == nil {
+		t.Fatal("expected error for stdlib function")
+	}
+	if !strings.Contains(err.Error(), "lower") {
+		t.Errorf("expected error naming lower, got: %v", err)
+	}
+
+	src = []byte(`
+database {
+    host = fileexists("missing.txt") ? "remote" : env("HOME", "localhost")
+    port = 5432
+}
+`)
+	if err := Load(src, "test.hcl", &cfg, WithoutStdlib()); err != nil {
+		t.Errorf("env and file functions should remain, got: %v", err)
+	}
+}
+
+func TestLoad_UserFunctionOverridesStdlib(t *testing.T) {
+	src := []byte(`
+database {
+    host = upper("localhost")
+    port = 5432
+}
+`)
+	ctx := &hcl.EvalContext{
+		Functions: map[string]function.Function{
+			"upper": function.New(&function.Spec{
+				Params: []function.Parameter{{Name: "s", Type: cty.String}},
+				Type:   function.StaticReturnType(cty.String),
+				Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+					return cty.StringVal("custom"), nil
+				},
+			}),
+		},
+	}
+	var cfg SimpleConfig
+	err := Load(src, "test.hcl", &cfg, WithEvalContext(ctx), WithoutFunctions("upper"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Database.Host != "custom" {
+		t.Errorf("host = %q, want %q", cfg.Database.Host, "custom")
+	}
+}
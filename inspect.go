@@ -0,0 +1,141 @@
+package hclconfig
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Graph is the dependency graph of a configuration. Nodes are keyed the way
+// they are referenced: "var.port", "local.url", "database.host" for an
+// attribute of a block, "database" for the block as a whole, or "timeout"
+// for a top-level attribute.
+type Graph struct {
+	// Nodes lists every node in evaluation order, or in source order when
+	// the graph has a cycle.
+	Nodes []string
+	// Deps maps each node to the sorted keys of the nodes it depends on.
+	Deps map[string][]string
+}
+
+// DOT renders the graph in Graphviz DOT syntax, with an edge from every node
+// to each node it depends on.
+func (g *Graph) DOT() string {
+	var b strings.Builder
+	b.WriteString("digraph config {\n")
+	for _, node := range g.Nodes {
+		fmt.Fprintf(&b, "  %q;\n", node)
+	}
+	for _, node := range g.Nodes {
+		for _, dep := range g.Deps[node] {
+			fmt.Fprintf(&b, "  %q -> %q;\n", node, dep)
+		}
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// Mermaid renders the graph as a Mermaid flowchart, with an edge from every
+// node to each node it depends on.
+func (g *Graph) Mermaid() string {
+	ids := make(map[string]string, len(g.Nodes))
+	var b strings.Builder
+	b.WriteString("graph LR\n")
+	for i, node := range g.Nodes {
+		ids[node] = fmt.Sprintf("n%d", i)
+		fmt.Fprintf(&b, "  %s[%q]\n", ids[node], node)
+	}
+	for _, node := range g.Nodes {
+		for _, dep := range g.Deps[node] {
+			fmt.Fprintf(&b, "  %s --> %s\n", ids[node], ids[dep])
+		}
+	}
+	return b.String()
+}
+
+// FileGraph returns the dependency graph of the configuration in filename,
+// which is read without a destination struct. A *CycleError is returned
+// together with the graph when the graph has a cycle; other errors found
+// while evaluating the configuration are not reported.
+func FileGraph(filename string, opts ...Option) (*Graph, error) {
+	var insp inspection
+	err := loadDynamicFile(filename, opts, &insp)
+	if insp.graph == nil {
+		return nil, err
+	}
+	var cycleErr *CycleError
+	if errors.As(err, &cycleErr) {
+		return insp.graph, err
+	}
+	return insp.graph, nil
+}
+
+// ValidateFile loads the configuration in filename without a destination
+// struct, checking its syntax, references, dependency graph and var values.
+// Blocks and attributes are accepted as written, since there is no schema to
+// check them against.
+func ValidateFile(filename string, opts ...Option) error {
+	return loadDynamicFile(filename, opts, nil)
+}
+
+// EvalFile evaluates expr against the fully resolved configuration in
+// filename, which is read without a destination struct. expr is an HCL
+// expression such as service.api.host, or a template such as
+// "${service.api.host}:${service.api.port}".
+func EvalFile(filename, expr string, opts ...Option) (cty.Value, error) {
+	var insp inspection
+	if err := loadDynamicFile(filename, opts, &insp); err != nil {
+		return cty.NilVal, err
+	}
+
+	var e hclsyntax.Expression
+	var diags hcl.Diagnostics
+	if strings.Contains(expr, "${") || strings.Contains(expr, "%{") {
+		e, diags = hclsyntax.ParseTemplate([]byte(expr), "<expr>", hcl.InitialPos)
+	} else {
+		e, diags = hclsyntax.ParseExpression([]byte(expr), "<expr>", hcl.InitialPos)
+	}
+	if diags.HasErrors() {
+		return cty.NilVal, &DiagnosticsError{Diags: diags}
+	}
+	val, diags := e.Value(insp.evalCtx)
+	if diags.HasErrors() {
+		return cty.NilVal, &DiagnosticsError{Diags: diags}
+	}
+	return val, nil
+}
+
+// inspection collects the internals of a load for the functions above.
+type inspection struct {
+	graph   *Graph
+	evalCtx *hcl.EvalContext // the fully resolved context, once loading succeeds
+}
+
+// recordGraph records the dependency graph. sorted is nil when the graph
+// could not be sorted.
+func (insp *inspection) recordGraph(nodes []blockInfo, sorted []string, deps map[string]map[string]bool) {
+	g := &Graph{Nodes: sorted, Deps: make(map[string][]string, len(deps))}
+	if g.Nodes == nil {
+		seen := make(map[string]bool, len(nodes))
+		for _, n := range nodes {
+			if key := n.key(); !seen[key] {
+				seen[key] = true
+				g.Nodes = append(g.Nodes, key)
+			}
+		}
+	}
+	for key, set := range deps {
+		list := make([]string, 0, len(set))
+		for dep := range set {
+			list = append(list, dep)
+		}
+		sort.Strings(list)
+		g.Deps[key] = list
+	}
+	insp.graph = g
+}
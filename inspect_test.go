@@ -0,0 +1,123 @@
+package hclconfig
+
+import (
+	"errors"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const inspectSrc = `var "port" {
+  default = 5432
+}
+locals {
+  scheme = "postgres"
+}
+database {
+  host = "localhost"
+  port = var.port
+}
+service "api" {
+  host = "api.local"
+}
+service "web" {
+  host = "web.local"
+}
+app {
+  db_url = "${local.scheme}://${database.host}:${database.port}"
+  hosts  = [for s in service : s.host]
+}
+`
+
+func TestEvalFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.hcl")
+	writeFile(t, path, inspectSrc)
+
+	val, err := EvalFile(path, "app.db_url")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := val.AsString(); got != "postgres://localhost:5432" {
+		t.Errorf("app.db_url = %q", got)
+	}
+
+	val, err = EvalFile(path, "${service.web.host}:${var.port}", WithVarFlags([]string{"port=6543"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := val.AsString(); got != "web.local:6543" {
+		t.Errorf("template = %q", got)
+	}
+
+	if _, err := EvalFile(path, "service.db.host"); err == nil {
+		t.Error("expected error for unknown block")
+	}
+}
+
+func TestValidateFile(t *testing.T) {
+	dir := t.TempDir()
+	good := filepath.Join(dir, "good.hcl")
+	writeFile(t, good, inspectSrc)
+	if err := ValidateFile(good); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	bad := filepath.Join(dir, "bad.hcl")
+	writeFile(t, bad, `a {
+  x = b.y
+}
+b {
+  y = missing
+}
+`)
+	err := ValidateFile(bad)
+	var diagErr *DiagnosticsError
+	if !errors.As(err, &diagErr) {
+		t.Fatalf("expected DiagnosticsError, got %T: %v", err, err)
+	}
+	if !strings.Contains(err.Error(), "missing") {
+		t.Errorf("expected unknown variable error, got: %v", err)
+	}
+}
+
+func TestFileGraph(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.hcl")
+	writeFile(t, path, inspectSrc)
+
+	g, err := FileGraph(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"database.host", "database.port", "local.scheme"}; !slices.Equal(g.Deps["app.db_url"], want) {
+		t.Errorf("app.db_url deps = %v, want %v", g.Deps["app.db_url"], want)
+	}
+	if i, j := slices.Index(g.Nodes, "var.port"), slices.Index(g.Nodes, "database.port"); i < 0 || j < i {
+		t.Errorf("var.port should come before database.port in %v", g.Nodes)
+	}
+	if dot := g.DOT(); !strings.Contains(dot, `"app.hosts" -> "service.web";`) {
+		t.Errorf("DOT output missing edge:\n%s", dot)
+	}
+	if mermaid := g.Mermaid(); !strings.HasPrefix(mermaid, "graph LR\n") || !strings.Contains(mermaid, "-->") {
+		t.Errorf("unexpected Mermaid output:\n%s", mermaid)
+	}
+}
+
+func TestFileGraph_Cycle(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.hcl")
+	writeFile(t, path, `a {
+  x = b.y
+}
+b {
+  y = a.x
+}
+`)
+	g, err := FileGraph(path)
+	var cycleErr *CycleError
+	if !errors.As(err, &cycleErr) {
+		t.Fatalf("expected CycleError, got %T: %v", err, err)
+	}
+	if g == nil || !slices.Equal(g.Deps["a.x"], []string{"b.y"}) {
+		t.Errorf("expected graph along with cycle error, got %+v", g)
+	}
+}
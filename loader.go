@@ -3,7 +3,10 @@ package hclconfig
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"reflect"
+	"sort"
+	"strings"
 
 	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/hcl/v2/gohcl"
@@ -15,17 +18,70 @@ import (
 type Option func(*options)
 
 type options struct {
-	evalCtx *hcl.EvalContext
+	evalCtx        *hcl.EvalContext
+	syntax         Syntax
+	variables      *[]Variable
+	provenance     *Provenance
+	vars           []map[string]any
+	varEnvPrefixes []string
+	varFiles       []string
+	varFlags       []string
+	excludeFuncs   map[string]bool
+	noStdlib       bool
+	strictEnv      bool
+	decoders       typeDecoders
+	encoders       typeEncoders
+	fileRoot       string
+	baseDir        string            // directory file() paths are relative to; set by the loader
+	onRead         func(path string) // called with each extra file a load reads; set by Watcher
+	inspect        *inspection       // collects the graph and eval context; set by the inspection functions
 }
 
+func newOptions(opts []Option) options {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// Syntax selects which HCL syntax is used to parse configuration source.
+type Syntax int
+
+const (
+	// SyntaxAuto parses files ending in ".json" (including ".hcl.json") as
+	// HCL JSON and everything else as native HCL syntax.
+	SyntaxAuto Syntax = iota
+	// SyntaxHCL always parses source as native HCL syntax.
+	SyntaxHCL
+	// SyntaxJSON always parses source as HCL JSON syntax.
+	SyntaxJSON
+)
+
 // WithEvalContext provides a custom HCL EvalContext that will be merged with
-// the built-in context (env function, resolved block variables).
+// the built-in context (built-in functions, resolved block variables).
 func WithEvalContext(ctx *hcl.EvalContext) Option {
 	return func(o *options) {
 		o.evalCtx = ctx
 	}
 }
 
+// WithStrictEnv makes env() without a default fail when the environment
+// variable is not set, instead of returning an empty string.
+func WithStrictEnv() Option {
+	return func(o *options) {
+		o.strictEnv = true
+	}
+}
+
+// WithSyntax overrides filename-based syntax detection, e.g. to load JSON
+// source that was not read from a file with a .json extension.
+func WithSyntax(syntax Syntax) Option {
+	return func(o *options) {
+		o.syntax = syntax
+	}
+}
+
 // LoadFile reads and parses an HCL file with cross-block variable resolution.
 func LoadFile(filename string, dst interface{}, opts ...Option) error {
 	src, err := os.ReadFile(filename)
@@ -35,32 +91,98 @@ func LoadFile(filename string, dst interface{}, opts ...Option) error {
 	return Load(src, filename, dst, opts...)
 }
 
-// Load parses HCL source bytes with cross-block variable resolution.
-func Load(src []byte, filename string, dst interface{}, opts ...Option) error {
-	var o options
-	for _, opt := range opts {
-		opt(&o)
+// LoadDir parses every *.hcl and *.hcl.json file in dir and decodes them as a
+// single merged configuration. References resolve across files, so a block in
+// one file may refer to a block or attribute defined in another.
+func LoadDir(dir string, dst interface{}, opts ...Option) error {
+	o := newOptions(opts)
+	o.baseDir = dir
+
+	var filenames []string
+	for _, pattern := range []string{"*.hcl", "*.hcl.json"} {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return fmt.Errorf("listing %s: %w", dir, err)
+		}
+		filenames = append(filenames, matches...)
+	}
+	if len(filenames) == 0 {
+		return fmt.Errorf("no *.hcl or *.hcl.json files found in %s", dir)
 	}
 
+	parser := hclparse.NewParser()
+	var files []*hcl.File
+	var diags hcl.Diagnostics
+	for _, filename := range filenames {
+		src, err := os.ReadFile(filename)
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", filename, err)
+		}
+		file, fileDiags := parseSource(parser, src, filename, o.syntax)
+		diags = append(diags, fileDiags...)
+		if file != nil {
+			files = append(files, file)
+		}
+	}
+	if diags.HasErrors() {
+		return &DiagnosticsError{Diags: diags}
+	}
+
+	return load(hcl.MergeFiles(files), dst, o)
+}
+
+// Load parses HCL source bytes with cross-block variable resolution. Source
+// is parsed as HCL JSON when filename ends in ".json" or WithSyntax(SyntaxJSON)
+// is given, and as native HCL syntax otherwise.
+func Load(src []byte, filename string, dst interface{}, opts ...Option) error {
+	o := newOptions(opts)
+	o.baseDir = filepath.Dir(filename)
+
 	// 1. Parse
 	parser := hclparse.NewParser()
-	file, diags := parser.ParseHCL(src, filename)
+	file, diags := parseSource(parser, src, filename, o.syntax)
 	if diags.HasErrors() {
 		return &DiagnosticsError{Diags: diags}
 	}
 
-	body := file.Body
+	return load(file.Body, dst, o)
+}
+
+// parseSource parses src with the parser matching syntax, falling back to the
+// filename extension when syntax is SyntaxAuto.
+func parseSource(parser *hclparse.Parser, src []byte, filename string, syntax Syntax) (*hcl.File, hcl.Diagnostics) {
+	if syntax == SyntaxJSON || (syntax == SyntaxAuto && strings.HasSuffix(filename, ".json")) {
+		return parser.ParseJSON(src, filename)
+	}
+	return parser.ParseHCL(src, filename)
+}
+
+// load decodes an already-parsed body (a single file or several merged files)
+// into dst, resolving references in dependency order.
+func load(body hcl.Body, dst interface{}, o options) (err error) {
+	// Keep the values of sensitive vars out of any error returned.
+	sensitive := make(map[string]cty.Value)
+	defer func() {
+		err = redactSensitive(err, sensitive)
+	}()
 
-	// 2. Extract var blocks using PartialContent
+	// 2. Extract var and locals blocks using PartialContent
 	varSchema := &hcl.BodySchema{
 		Blocks: []hcl.BlockHeaderSchema{
 			{Type: "var", LabelNames: []string{"name"}},
+			{Type: "locals"},
 		},
 	}
 	varContent, remainBody, diags := body.PartialContent(varSchema)
 	if diags.HasErrors() {
 		return &DiagnosticsError{Diags: diags}
 	}
+	blocksByType := varContent.Blocks.ByType()
+	varBlocks := blocksByType["var"]
+	locals, diags := collectLocals(blocksByType["locals"])
+	if diags.HasErrors() {
+		return &DiagnosticsError{Diags: diags}
+	}
 
 	// 3. Extract user schema from remaining body
 	schema, _ := gohcl.ImpliedBodySchema(dst)
@@ -69,64 +191,80 @@ func Load(src []byte, filename string, dst interface{}, opts ...Option) error {
 		return &DiagnosticsError{Diags: diags}
 	}
 
+	// Reject blocks defined more than once, whether in one file or across the
+	// files merged by LoadDir.
+	diags = findDuplicateBlocks(varBlocks, nil)
+	diags = append(diags, findDuplicateBlocks(content.Blocks, reflect.TypeOf(dst).Elem())...)
+	if diags.HasErrors() {
+		return &DiagnosticsError{Diags: diags}
+	}
+
 	// 4. Build block info lists
-	varBlockInfos := make([]blockInfo, len(varContent.Blocks))
-	for i, block := range varContent.Blocks {
+	varBlockInfos := make([]blockInfo, len(varBlocks))
+	for i, block := range varBlocks {
 		varBlockInfos[i] = blockInfo{
 			typeName: "var",
-			label:    block.Labels[0],
+			labels:   block.Labels[:1],
+			isVar:    true,
 		}
 	}
 
+	// Unlabeled repeatable blocks are referenced by their position among the
+	// blocks of their type, e.g. listener[0].
+	repeatable := repeatableBlocks(reflect.TypeOf(dst).Elem())
+	elemCounts := make(map[string]int)
 	userBlockInfos := make([]blockInfo, len(content.Blocks))
 	for i, block := range content.Blocks {
-		label := ""
-		if len(block.Labels) > 0 {
-			label = block.Labels[0]
-		}
 		userBlockInfos[i] = blockInfo{
 			typeName: block.Type,
-			label:    label,
+			labels:   block.Labels,
 			index:    i,
 		}
+		if repeatable[block.Type] && len(block.Labels) == 0 {
+			userBlockInfos[i].repeated = true
+			userBlockInfos[i].elem = elemCounts[block.Type]
+			elemCounts[block.Type]++
+		}
 	}
 
-	// 5. Build dependency graph with combined blocks and topological sort
-	allBlocks := make([]*hcl.Block, 0, len(varContent.Blocks)+len(content.Blocks))
-	allBlocks = append(allBlocks, varContent.Blocks...)
+	// 5. Build the attribute-level dependency graph over var blocks, locals,
+	// user blocks and top-level attributes, and sort it topologically
+	allBlocks := make([]*hcl.Block, 0, len(varBlocks)+len(content.Blocks))
+	allBlocks = append(allBlocks, varBlocks...)
 	allBlocks = append(allBlocks, content.Blocks...)
 
 	allBlockInfos := make([]blockInfo, 0, len(varBlockInfos)+len(userBlockInfos))
 	allBlockInfos = append(allBlockInfos, varBlockInfos...)
 	allBlockInfos = append(allBlockInfos, userBlockInfos...)
 
-	deps := buildDependencyGraph(allBlocks, allBlockInfos, content.Attributes)
-
-	var allInfos []blockInfo
-	allInfos = append(allInfos, allBlockInfos...)
-	for name := range content.Attributes {
-		allInfos = append(allInfos, blockInfo{typeName: name, isAttr: true})
+	nodes, deps, diags := buildDependencyGraph(allBlocks, allBlockInfos, content.Attributes, locals)
+	if diags.HasErrors() {
+		return &DiagnosticsError{Diags: diags}
 	}
 
-	sortedKeys, err := topoSort(allInfos, deps)
+	sortedKeys, err := topoSort(nodes, deps)
+	if o.inspect != nil {
+		o.inspect.recordGraph(nodes, sortedKeys, deps)
+	}
 	if err != nil {
 		return err
 	}
 
+	nodesByKey := make(map[string]blockInfo, len(nodes))
+	for _, n := range nodes {
+		nodesByKey[n.key()] = n
+	}
+
 	// 6. Build eval context
-	evalCtx := newBaseEvalContext(o.evalCtx)
+	evalCtx := newBaseEvalContext(o)
 
-	// 7. Decode in topological order (both blocks and attributes)
+	// 7. Decode in topological order (var blocks, attributes, block members
+	// and whole blocks)
 	dstVal := reflect.ValueOf(dst).Elem()
 	dstType := dstVal.Type()
 
 	// Build maps from name -> field info for blocks and attributes
-	type fieldInfo struct {
-		fieldIndex int
-		isSlice    bool
-		isPtr      bool
-	}
-	blockFieldMap := make(map[string]fieldInfo)
+	blockFieldMap := make(map[string]blockFieldInfo)
 	attrFieldMap := make(map[string]int) // attr name -> struct field index
 	for i := 0; i < dstType.NumField(); i++ {
 		field := dstType.Field(i)
@@ -140,7 +278,7 @@ func Load(src []byte, filename string, dst interface{}, opts ...Option) error {
 			ft := field.Type
 			isPtr := ft.Kind() == reflect.Ptr
 			isSlice := ft.Kind() == reflect.Slice
-			blockFieldMap[name] = fieldInfo{
+			blockFieldMap[name] = blockFieldInfo{
 				fieldIndex: i,
 				isSlice:    isSlice,
 				isPtr:      isPtr,
@@ -150,197 +288,565 @@ func Load(src []byte, filename string, dst interface{}, opts ...Option) error {
 		}
 	}
 
-	// Build set of attribute names for dispatch in the decode loop
-	attrNames := make(map[string]bool)
-	for name := range content.Attributes {
-		attrNames[name] = true
+	// Parse var declarations and collect the values supplied for them from
+	// outside the configuration
+	decls := make(map[string]*varDecl)
+	for _, block := range varBlocks {
+		decl, declDiags := decodeVarBlock(block)
+		diags = append(diags, declDiags...)
+		if decl != nil {
+			decls[decl.Name] = decl
+		}
+	}
+	if diags.HasErrors() {
+		return &DiagnosticsError{Diags: diags}
+	}
+	overrides, err := o.varOverrides(decls)
+	if err != nil {
+		return err
 	}
 
-	// Group var blocks by key
-	varBlocksByKey := make(map[string]*hcl.Block)
-	for i, bi := range varBlockInfos {
-		varBlocksByKey[bi.key()] = varContent.Blocks[i]
+	// Prepare a decode target for every user block so that its members can
+	// be decoded and published one at a time
+	statesByKey := make(map[string][]*blockState)
+	statesByType := make(map[string][]*blockState)
+	blockStates := newBlockStates(dstVal, blockFieldMap, content.Blocks, userBlockInfos)
+	for _, state := range blockStates {
+		statesByKey[state.info.blockKey()] = append(statesByKey[state.info.blockKey()], state)
+		statesByType[state.info.typeName] = append(statesByType[state.info.typeName], state)
 	}
 
-	// Group user blocks by key for decoding
-	blocksByKey := make(map[string][]*hcl.Block)
-	blockInfoByKey := make(map[string][]blockInfo)
-	for i, bi := range userBlockInfos {
-		key := bi.key()
-		blocksByKey[key] = append(blocksByKey[key], content.Blocks[i])
-		blockInfoByKey[key] = append(blockInfoByKey[key], bi)
+	// Fill in omitted attributes that have a default tag, so that references
+	// see the defaults
+	for _, state := range blockStates {
+		applied, defaultDiags := applyDefaults(state.target, state.block.Body, o.decoders)
+		diags = append(diags, defaultDiags...)
+		for _, name := range applied {
+			fieldIndex, _, _ := fieldByHCLName(state.target.Type(), name)
+			if val, err := reflectToCtyValue(state.target.Field(fieldIndex), o.encoders); err == nil && val != cty.NilVal {
+				state.values[name] = val
+			}
+		}
+	}
+	applied, defaultDiags := applyDefaults(dstVal, remainBody, o.decoders)
+	diags = append(diags, defaultDiags...)
+	for _, name := range applied {
+		if val, err := reflectToCtyValue(dstVal.Field(attrFieldMap[name]), o.encoders); err == nil && val != cty.NilVal {
+			evalCtx.Variables[name] = val
+		}
+	}
+	if diags.HasErrors() {
+		return &DiagnosticsError{Diags: diags}
 	}
 
 	varValues := make(map[string]cty.Value)
+	localValues := make(map[string]cty.Value)
+
+	// evalNode decodes a single node of the dependency graph and publishes its
+	// value in the eval context.
+	evalNode := func(node blockInfo) error {
+		key := node.key()
 
-	for _, key := range sortedKeys {
 		// --- Var block ---
-		if varBlock, ok := varBlocksByKey[key]; ok {
-			attrs, diags := varBlock.Body.JustAttributes()
-			if diags.HasErrors() {
-				return &DiagnosticsError{Diags: diags}
+		if node.isVar {
+			decl := decls[node.label()]
+			var override *varOverride
+			if ov, ok := overrides[decl.Name]; ok {
+				override = &ov
+			}
+			val, err := decl.value(evalCtx, override)
+			if err != nil {
+				return err
 			}
-			defaultAttr, ok := attrs["default"]
-			if !ok {
-				return fmt.Errorf("%s:%d: var %q missing required \"default\" attribute",
-					varBlock.DefRange.Filename, varBlock.DefRange.Start.Line, varBlock.Labels[0])
+			decl.Value = val
+			if decl.Sensitive {
+				sensitive[decl.Name] = val
 			}
-			val, diags := defaultAttr.Expr.Value(evalCtx)
+			varValues[decl.Name] = val
+			evalCtx.Variables["var"] = cty.ObjectVal(varValues)
+			return decl.validate(evalCtx)
+		}
+
+		// --- Local value ---
+		if node.isLocal {
+			val, diags := locals[node.label()].Expr.Value(evalCtx)
 			if diags.HasErrors() {
 				return &DiagnosticsError{Diags: diags}
 			}
-			varValues[varBlock.Labels[0]] = val
-			evalCtx.Variables["var"] = cty.ObjectVal(varValues)
-			continue
+			localValues[node.label()] = val
+			evalCtx.Variables["local"] = cty.ObjectVal(localValues)
+			return nil
 		}
 
 		// --- Top-level attribute ---
-		if attrNames[key] {
+		if node.isAttr {
 			attr := content.Attributes[key]
+			if fi, ok := attrFieldMap[key]; ok {
+				if t := dstVal.Field(fi).Type(); t == exprType || t == attrType {
+					// Captured as written; as for block members, the value
+					// is published only if it can be evaluated.
+					if _, diags := decodeAttribute(attr, evalCtx, dstVal.Field(fi), o.decoders); diags.HasErrors() {
+						return &DiagnosticsError{Diags: diags}
+					}
+					if val, diags := attr.Expr.Value(evalCtx); !diags.HasErrors() {
+						evalCtx.Variables[key] = val
+					}
+					return nil
+				}
+			}
 			val, diags := attr.Expr.Value(evalCtx)
 			if diags.HasErrors() {
 				return &DiagnosticsError{Diags: diags}
 			}
 			if fi, ok := attrFieldMap[key]; ok {
-				if err := setCtyValueOnField(dstVal.Field(fi), val); err != nil {
-					r := attr.Expr.Range()
-					return fmt.Errorf("%s:%d,%d: attribute %q: %w", r.Filename, r.Start.Line, r.Start.Column, key, err)
+				if diags := setAttributeDiags(dstVal.Field(fi), attr, val, o.decoders); diags.HasErrors() {
+					return &DiagnosticsError{Diags: diags}
 				}
 			}
 			evalCtx.Variables[key] = val
-			continue
+			return nil
 		}
 
-		// --- Block ---
-		blocks := blocksByKey[key]
-		if len(blocks) == 0 {
+		states := statesByKey[node.blockKey()]
+		if len(states) == 0 {
+			return nil
+		}
+
+		// --- Block member or whole block ---
+		// A member node decodes one attribute or nested block type of every
+		// block with this key. For a whole block every member is already
+		// decoded; decoding the whole body validates it against the schema
+		// and fills in omitted optional fields.
+		var diags hcl.Diagnostics
+		for _, state := range states {
+			var err error
+			blockCtx := state.evalContext(evalCtx)
+			if node.member != "" {
+				err = state.decodeMember(node.member, blockCtx, o.decoders, o.encoders)
+			} else {
+				err = state.decode(blockCtx, o.decoders, o.encoders)
+			}
+			if err != nil {
+				diags = append(diags, errorDiags(err)...)
+			}
+		}
+		publishBlocks(evalCtx, node.typeName, statesByType[node.typeName], blockFieldMap[node.typeName])
+		if diags.HasErrors() {
+			return &DiagnosticsError{Diags: diags}
+		}
+		return nil
+	}
+
+	// nodeRange returns the source range a skipped node is reported at.
+	nodeRange := func(node blockInfo) hcl.Range {
+		switch {
+		case node.isVar:
+			return decls[node.label()].DeclRange
+		case node.isLocal:
+			return locals[node.label()].NameRange
+		case node.isAttr:
+			return content.Attributes[node.typeName].NameRange
+		}
+		states := statesByKey[node.blockKey()]
+		if len(states) == 0 {
+			return hcl.Range{}
+		}
+		return states[0].memberRange(node.member)
+	}
+
+	// Keep going past failures so that every independent error is reported.
+	// failed maps each node that failed, or was skipped, to the node whose
+	// failure caused it.
+	loadDiags := checkRequired(dstType, remainBody)
+	failed := make(map[string]string)
+	for _, key := range sortedKeys {
+		node := nodesByKey[key]
+		if cause, ok := failedDependency(deps[key], failed); ok {
+			failed[key] = cause
+			// A whole block whose member failed needs no note of its own.
+			if node.member != "" || node.isVar || node.isLocal || node.isAttr {
+				loadDiags = append(loadDiags, &hcl.Diagnostic{
+					Severity: hcl.DiagWarning,
+					Summary:  "Skipped evaluation",
+					Detail:   fmt.Sprintf("%s was not evaluated because %s failed.", key, cause),
+					Subject:  nodeRange(node).Ptr(),
+				})
+			}
 			continue
 		}
+		if err := evalNode(node); err != nil {
+			failed[key] = key
+			loadDiags = append(loadDiags, errorDiags(err)...)
+		}
+	}
+	if !loadDiags.HasErrors() {
+		loadDiags = append(loadDiags, checkConstraints(dstVal, content.Attributes, remainBody.MissingItemRange())...)
+	}
+	if !loadDiags.HasErrors() {
+		loadDiags = append(loadDiags, runValidators(dstVal, evalCtx, remainBody.MissingItemRange())...)
+	}
+	if loadDiags.HasErrors() {
+		return &DiagnosticsError{Diags: loadDiags}
+	}
+
+	if o.inspect != nil {
+		o.inspect.evalCtx = evalCtx
+	}
+
+	if o.provenance != nil {
+		o.provenance.record(remainBody, dstVal.Type(), decls, overrides, locals, o.evalCtx)
+	}
+
+	if o.variables != nil {
+		vars := make([]Variable, 0, len(varBlockInfos))
+		for _, bi := range varBlockInfos {
+			vars = append(vars, decls[bi.label()].Variable)
+		}
+		*o.variables = vars
+	}
 
-		typeName := blocks[0].Type
+	return nil
+}
+
+// blockFieldInfo describes the destination struct field for a block type.
+type blockFieldInfo struct {
+	fieldIndex int
+	isSlice    bool
+	isPtr      bool
+}
+
+// blockState tracks a user block whose members are decoded one at a time in
+// dependency order.
+type blockState struct {
+	block   *hcl.Block
+	info    blockInfo
+	target  reflect.Value        // addressable struct the block decodes into
+	content *hcl.BodyContent     // block body split by the target's schema
+	values  map[string]cty.Value // members decoded so far
+	object  cty.Value            // the whole block, once decoded
+}
+
+// newBlockStates allocates the destination value of every user block in dst,
+// so slice fields keep the order in which blocks appear in the source.
+func newBlockStates(dstVal reflect.Value, blockFieldMap map[string]blockFieldInfo, blocks []*hcl.Block, infos []blockInfo) []*blockState {
+	byType := make(map[string][]int)
+	var typeOrder []string
+	for i, block := range blocks {
+		if _, ok := byType[block.Type]; !ok {
+			typeOrder = append(typeOrder, block.Type)
+		}
+		byType[block.Type] = append(byType[block.Type], i)
+	}
+
+	states := make([]*blockState, 0, len(blocks))
+	for _, typeName := range typeOrder {
 		fi, ok := blockFieldMap[typeName]
 		if !ok {
 			continue
 		}
-
 		fieldVal := dstVal.Field(fi.fieldIndex)
+		indexes := byType[typeName]
 
-		if fi.isSlice {
-			err := decodeSliceBlocks(fieldVal, blocks, evalCtx)
-			if err != nil {
-				return err
-			}
-		} else if fi.isPtr {
+		var targets []reflect.Value
+		switch {
+		case fi.isSlice:
 			elemType := fieldVal.Type().Elem()
-			newVal := reflect.New(elemType)
-			diags := gohcl.DecodeBody(blocks[0].Body, evalCtx, newVal.Interface())
-			if diags.HasErrors() {
-				return wrapBlockDiags(blocks[0], diags)
-			}
-			fieldVal.Set(newVal)
-		} else {
-			diags := gohcl.DecodeBody(blocks[0].Body, evalCtx, fieldVal.Addr().Interface())
-			if diags.HasErrors() {
-				return wrapBlockDiags(blocks[0], diags)
+			slice := reflect.MakeSlice(fieldVal.Type(), len(indexes), len(indexes))
+			for i := range indexes {
+				if elemType.Kind() == reflect.Ptr {
+					elem := reflect.New(elemType.Elem())
+					slice.Index(i).Set(elem)
+					targets = append(targets, elem.Elem())
+				} else {
+					targets = append(targets, slice.Index(i))
+				}
 			}
+			fieldVal.Set(slice)
+		case fi.isPtr:
+			elem := reflect.New(fieldVal.Type().Elem())
+			fieldVal.Set(elem)
+			targets = append(targets, elem.Elem())
+		default:
+			targets = append(targets, fieldVal)
 		}
 
-		// After decoding block, add to eval context
-		infos := blockInfoByKey[key]
-		if fi.isSlice && len(infos) > 0 && infos[0].label != "" {
-			addLabeledSliceToEvalCtx(evalCtx, typeName, fieldVal)
-		} else if fi.isSlice {
-			val, err := structToCtyValue(fieldVal.Interface())
-			if err == nil && val != cty.NilVal {
-				evalCtx.Variables[typeName] = val
-			}
-		} else {
-			var iface interface{}
-			if fi.isPtr {
-				if !fieldVal.IsNil() {
-					iface = fieldVal.Elem().Interface()
-				}
-			} else {
-				iface = fieldVal.Interface()
-			}
-			if iface != nil {
-				val, err := structToCtyValue(iface)
-				if err == nil && val != cty.NilVal {
-					evalCtx.Variables[typeName] = val
-				}
-			}
+		for i, idx := range indexes {
+			block := blocks[idx]
+			setLabelFields(targets[i], block.Labels)
+			schema, _ := gohcl.ImpliedBodySchema(targets[i].Addr().Interface())
+			// Schema errors are reported when the whole block is decoded.
+			content, _, _ := block.Body.PartialContent(schema)
+			states = append(states, &blockState{
+				block:   block,
+				info:    infos[idx],
+				target:  targets[i],
+				content: content,
+				values:  make(map[string]cty.Value),
+			})
 		}
 	}
+	return states
+}
+
+// decodeMember decodes a single attribute or nested block type of the block
+// into its target field and records its value for references from other
+// blocks.
+func (s *blockState) decodeMember(name string, evalCtx *hcl.EvalContext, decoders typeDecoders, encoders typeEncoders) error {
+	fieldIndex, kind, ok := fieldByHCLName(s.target.Type(), name)
+	if !ok || s.content == nil {
+		return nil
+	}
+	fieldVal := s.target.Field(fieldIndex)
 
+	if kind == "block" {
+		blocks := s.content.Blocks.ByType()[name]
+		if diags := decodeBlockField(fieldVal, name, blocks, s.block.Body, evalCtx, decoders); diags.HasErrors() {
+			return wrapBlockDiags(s.block, diags)
+		}
+		val, err := blockFieldToCtyValue(fieldVal, encoders)
+		if err == nil && val != cty.NilVal {
+			s.values[name] = val
+		}
+		return nil
+	}
+
+	attr, ok := s.content.Attributes[name]
+	if !ok {
+		return nil
+	}
+	if t := fieldVal.Type(); t == exprType || t == attrType {
+		// Fields such as hcl.Expression are left to the whole-block decode
+		// and may refer to variables only the application defines, so the
+		// value is published for references only if it can be evaluated.
+		if val, diags := attr.Expr.Value(evalCtx); !diags.HasErrors() {
+			s.values[name] = val
+		}
+		return nil
+	}
+	if _, diags := decodeAttribute(attr, evalCtx, fieldVal, decoders); diags.HasErrors() {
+		return wrapBlockDiags(s.block, diags)
+	}
+	val, err := reflectToCtyValue(fieldVal, encoders)
+	if err == nil && val != cty.NilVal {
+		s.values[name] = val
+	}
 	return nil
 }
 
-// setCtyValueOnField sets a struct field from a cty.Value.
-func setCtyValueOnField(fieldVal reflect.Value, val cty.Value) error {
-	switch fieldVal.Kind() {
-	case reflect.String:
-		fieldVal.SetString(val.AsString())
-	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		bf := val.AsBigFloat()
-		i, _ := bf.Int64()
-		fieldVal.SetInt(i)
-	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-		bf := val.AsBigFloat()
-		u, _ := bf.Uint64()
-		fieldVal.SetUint(u)
-	case reflect.Float32, reflect.Float64:
-		bf := val.AsBigFloat()
-		f, _ := bf.Float64()
-		fieldVal.SetFloat(f)
-	case reflect.Bool:
-		fieldVal.SetBool(val.True())
-	case reflect.Slice:
-		return setSliceFromCty(fieldVal, val)
-	default:
-		return fmt.Errorf("unsupported field kind %s", fieldVal.Kind())
+// memberRange returns the range of the named attribute or first nested block
+// of that type, or the block's own range when there is neither.
+func (s *blockState) memberRange(name string) hcl.Range {
+	if s.content != nil {
+		if attr, ok := s.content.Attributes[name]; ok {
+			return attr.NameRange
+		}
+		for _, block := range s.content.Blocks {
+			if block.Type == name {
+				return block.DefRange
+			}
+		}
+	}
+	return s.block.DefRange
+}
+
+// decode decodes the whole block body into its target.
+func (s *blockState) decode(evalCtx *hcl.EvalContext, decoders typeDecoders, encoders typeEncoders) error {
+	diags := decodeBody(s.block.Body, evalCtx, s.target, decoders)
+	if diags.HasErrors() {
+		return wrapBlockDiags(s.block, diags)
+	}
+	// Nested blocks get their defaults as they are decoded; the block's own
+	// attributes still need theirs.
+	if _, diags := applyDefaults(s.target, s.block.Body, decoders); diags.HasErrors() {
+		return wrapBlockDiags(s.block, diags)
+	}
+	if diags := validateBlock(s.target, s.block, evalCtx); diags.HasErrors() {
+		return &DiagnosticsError{Diags: diags}
+	}
+	val, err := structFieldsToCtyObject(s.target, encoders)
+	if err == nil && val != cty.NilVal {
+		s.object = s.withExpressionValues(val)
 	}
 	return nil
 }
 
-func setSliceFromCty(fieldVal reflect.Value, val cty.Value) error {
-	if !val.Type().IsListType() && !val.Type().IsTupleType() && !val.Type().IsSetType() {
-		return fmt.Errorf("cannot convert %s to slice", val.Type().FriendlyName())
+// withExpressionValues adds to the block object val the values decodeMember
+// evaluated for hcl.Expression and *hcl.Attribute fields, which the decoded
+// struct does not hold.
+func (s *blockState) withExpressionValues(val cty.Value) cty.Value {
+	attrs := val.AsValueMap()
+	for name, v := range s.values {
+		fieldIndex, _, ok := fieldByHCLName(s.target.Type(), name)
+		if !ok {
+			continue
+		}
+		if t := s.target.Field(fieldIndex).Type(); t == exprType || t == attrType {
+			if attrs == nil {
+				attrs = make(map[string]cty.Value)
+			}
+			attrs[name] = v
+		}
+	}
+	if len(attrs) == 0 {
+		return val
 	}
-	elems := val.AsValueSlice()
-	slice := reflect.MakeSlice(fieldVal.Type(), len(elems), len(elems))
-	for i, elem := range elems {
-		if err := setCtyValueOnField(slice.Index(i), elem); err != nil {
-			return fmt.Errorf("element %d: %w", i, err)
+	return cty.ObjectVal(attrs)
+}
+
+// value returns the block's value as seen by references: the whole block once
+// decoded, otherwise an object of the members decoded so far.
+func (s *blockState) value() cty.Value {
+	if s.object != cty.NilVal {
+		return s.object
+	}
+	if len(s.values) == 0 {
+		return cty.EmptyObjectVal
+	}
+	return cty.ObjectVal(s.values)
+}
+
+// evalContext returns a child of evalCtx in which self refers to the block,
+// as far as it has been decoded.
+func (s *blockState) evalContext(evalCtx *hcl.EvalContext) *hcl.EvalContext {
+	ctx := evalCtx.NewChild()
+	ctx.Variables = map[string]cty.Value{selfName: s.value()}
+	return ctx
+}
+
+// publishBlocks exposes every block of typeName in the eval context: objects
+// nested by label for labeled blocks, whether singleton or repeated, a single
+// object for unlabeled singleton blocks and a tuple for unlabeled repeated
+// blocks.
+func publishBlocks(evalCtx *hcl.EvalContext, typeName string, states []*blockState, fi blockFieldInfo) {
+	if len(states) == 0 {
+		return
+	}
+	switch {
+	case len(states[0].info.labels) > 0:
+		labels := make([][]string, len(states))
+		vals := make([]cty.Value, len(states))
+		for i, state := range states {
+			labels[i] = state.info.labels
+			vals[i] = state.value()
+		}
+		evalCtx.Variables[typeName] = labeledObject(labels, vals)
+	case !fi.isSlice:
+		evalCtx.Variables[typeName] = states[0].value()
+	default:
+		vals := make([]cty.Value, len(states))
+		for i, state := range states {
+			vals[i] = state.value()
 		}
+		evalCtx.Variables[typeName] = cty.TupleVal(vals)
 	}
-	fieldVal.Set(slice)
-	return nil
 }
 
-func decodeSliceBlocks(fieldVal reflect.Value, blocks []*hcl.Block, evalCtx *hcl.EvalContext) error {
-	elemType := fieldVal.Type().Elem()
-	isElemPtr := elemType.Kind() == reflect.Ptr
-	if isElemPtr {
-		elemType = elemType.Elem()
+// fieldByHCLName finds the struct field tagged with the given HCL name.
+func fieldByHCLName(rt reflect.Type, name string) (int, string, bool) {
+	for i := 0; i < rt.NumField(); i++ {
+		tag := rt.Field(i).Tag.Get("hcl")
+		if tag == "" {
+			continue
+		}
+		fieldName, kind := parseHCLTag(tag)
+		if fieldName == name && kind != "label" {
+			return i, kind, true
+		}
+	}
+	return 0, "", false
+}
+
+// failedDependency reports the root cause if any of deps failed or was
+// skipped.
+func failedDependency(deps map[string]bool, failed map[string]string) (string, bool) {
+	keys := make([]string, 0, len(deps))
+	for dep := range deps {
+		keys = append(keys, dep)
 	}
+	sort.Strings(keys)
+	for _, dep := range keys {
+		if cause, ok := failed[dep]; ok {
+			return cause, true
+		}
+	}
+	return "", false
+}
 
+// collectLocals merges the attributes of every locals block, reporting local
+// values defined more than once.
+func collectLocals(blocks []*hcl.Block) (hcl.Attributes, hcl.Diagnostics) {
+	locals := make(hcl.Attributes)
+	var diags hcl.Diagnostics
 	for _, block := range blocks {
-		newVal := reflect.New(elemType)
-		// Set label fields before decoding
-		setLabelFields(newVal.Elem(), block.Labels)
+		attrs, attrDiags := block.Body.JustAttributes()
+		diags = append(diags, attrDiags...)
+		for _, attr := range sortedAttributes(attrs) {
+			if prev, ok := locals[attr.Name]; ok {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Duplicate local value",
+					Detail:   fmt.Sprintf("A local value named %q was already defined at %s", attr.Name, prev.NameRange.String()),
+					Subject:  attr.NameRange.Ptr(),
+				})
+				continue
+			}
+			locals[attr.Name] = attr
+		}
+	}
+	return locals, diags
+}
 
-		diags := gohcl.DecodeBody(block.Body, evalCtx, newVal.Interface())
-		if diags.HasErrors() {
-			return wrapBlockDiags(block, diags)
+// findDuplicateBlocks reports blocks that share a type and labels but map to a
+// single value: singleton struct fields of dstType, or every block when dstType
+// is nil (as for var blocks). Slice fields may legitimately repeat.
+func findDuplicateBlocks(blocks []*hcl.Block, dstType reflect.Type) hcl.Diagnostics {
+	repeatable := repeatableBlocks(dstType)
+
+	var diags hcl.Diagnostics
+	seen := make(map[string]*hcl.Block)
+	for _, block := range blocks {
+		// Unlabeled repeatable blocks are told apart by position; labeled
+		// ones must have a unique label tuple.
+		if repeatable[block.Type] && len(block.Labels) == 0 {
+			continue
+		}
+		name := block.Type
+		for _, label := range block.Labels {
+			name += fmt.Sprintf(" %q", label)
+		}
+		if prev, ok := seen[name]; ok {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Duplicate block",
+				Detail:   fmt.Sprintf("A %s block was already defined at %s", name, prev.DefRange.String()),
+				Subject:  block.DefRange.Ptr(),
+			})
+			continue
 		}
+		seen[name] = block
+	}
+	return diags
+}
 
-		if isElemPtr {
-			fieldVal.Set(reflect.Append(fieldVal, newVal))
-		} else {
-			fieldVal.Set(reflect.Append(fieldVal, newVal.Elem()))
+// repeatableBlocks returns the block types the struct type dstType decodes
+// into slices, which may occur more than once.
+func repeatableBlocks(dstType reflect.Type) map[string]bool {
+	repeatable := make(map[string]bool)
+	if dstType == nil {
+		return repeatable
+	}
+	for i := 0; i < dstType.NumField(); i++ {
+		field := dstType.Field(i)
+		tag := field.Tag.Get("hcl")
+		if tag == "" {
+			continue
+		}
+		name, kind := parseHCLTag(tag)
+		if kind == "block" && field.Type.Kind() == reflect.Slice {
+			repeatable[name] = true
 		}
 	}
-	return nil
+	return repeatable
 }
 
 func setLabelFields(rv reflect.Value, labels []string) {
@@ -363,8 +869,8 @@ func setLabelFields(rv reflect.Value, labels []string) {
 // so that errors clearly identify which block caused the failure.
 func wrapBlockDiags(block *hcl.Block, diags hcl.Diagnostics) error {
 	label := ""
-	if len(block.Labels) > 0 {
-		label = fmt.Sprintf(" %q", block.Labels[0])
+	for _, l := range block.Labels {
+		label += fmt.Sprintf(" %q", l)
 	}
 	wrapped := make(hcl.Diagnostics, len(diags))
 	for i, d := range diags {
@@ -386,24 +892,3 @@ func wrapBlockDiags(block *hcl.Block, diags hcl.Diagnostics) error {
 	}
 	return &DiagnosticsError{Diags: wrapped}
 }
-
-func addLabeledSliceToEvalCtx(evalCtx *hcl.EvalContext, typeName string, sliceVal reflect.Value) {
-	labelMap := make(map[string]cty.Value)
-	for i := 0; i < sliceVal.Len(); i++ {
-		elem := sliceVal.Index(i)
-		for elem.Kind() == reflect.Ptr {
-			elem = elem.Elem()
-		}
-		label := getLabelValue(elem)
-		if label == "" {
-			continue
-		}
-		val, err := structFieldsToCtyObject(elem)
-		if err == nil && val != cty.NilVal {
-			labelMap[label] = val
-		}
-	}
-	if len(labelMap) > 0 {
-		evalCtx.Variables[typeName] = cty.ObjectVal(labelMap)
-	}
-}
@@ -0,0 +1,236 @@
+package hclconfig
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+// SourceKind says where a value came from.
+type SourceKind int
+
+const (
+	// SourceLiteral is a constant expression in the configuration.
+	SourceLiteral SourceKind = iota
+	// SourceReference is an expression that refers to other values in the
+	// configuration, such as blocks, attributes, locals or vars.
+	SourceReference
+	// SourceEnv is an environment variable, read through env() and related
+	// functions or supplied to a var through WithVarsFromEnv.
+	SourceEnv
+	// SourceEvalContext is an expression that refers to a variable supplied
+	// through WithEvalContext.
+	SourceEvalContext
+	// SourceVarDefault is the default of a var block.
+	SourceVarDefault
+	// SourceOverride is a var value supplied through WithVars, WithVarsFile or
+	// WithVarFlags.
+	SourceOverride
+	// SourceTagDefault is the default tag of a field whose attribute the
+	// configuration omits.
+	SourceTagDefault
+)
+
+func (k SourceKind) String() string {
+	switch k {
+	case SourceLiteral:
+		return "literal"
+	case SourceReference:
+		return "reference"
+	case SourceEnv:
+		return "env"
+	case SourceEvalContext:
+		return "eval context"
+	case SourceVarDefault:
+		return "var default"
+	case SourceOverride:
+		return "override"
+	case SourceTagDefault:
+		return "tag default"
+	}
+	return fmt.Sprintf("SourceKind(%d)", int(k))
+}
+
+// ValueSource describes where a single value came from.
+type ValueSource struct {
+	Kind SourceKind
+	// Range is the definition that set the value. It is zero for var values
+	// supplied from outside the configuration other than through a vars file,
+	// and is the body that omits the attribute for a default tag.
+	Range hcl.Range
+	// Traversals are the references the value's expression depends on, such
+	// as var.db_host or database.port. Follow them through Vars, Locals and
+	// Fields to trace an interpolated value back to its inputs.
+	Traversals []hcl.Traversal
+	// Detail names the source of a var override, e.g.
+	// "environment variable APP_VAR_db_host", or quotes a default tag, e.g.
+	// `default tag "5432"`.
+	Detail string
+}
+
+// Provenance records where every value decoded by a load came from.
+type Provenance struct {
+	// Fields is keyed by the destination field path, built from Go field
+	// names, e.g. "App.DBUrl", "Services[0].Port" or "App.Credentials.Username".
+	Fields map[string]*ValueSource
+	// Vars is keyed by var name.
+	Vars map[string]*ValueSource
+	// Locals is keyed by local value name.
+	Locals map[string]*ValueSource
+}
+
+// WithProvenance fills in *p with the origin of every decoded field, var and
+// local value once loading succeeds.
+func WithProvenance(p *Provenance) Option {
+	return func(o *options) {
+		o.provenance = p
+	}
+}
+
+// record fills in p from the configuration body that was decoded into a
+// value of type rt.
+func (p *Provenance) record(body hcl.Body, rt reflect.Type, decls map[string]*varDecl, overrides map[string]varOverride, locals map[string]*hcl.Attribute, userCtx *hcl.EvalContext) {
+	p.Fields = make(map[string]*ValueSource)
+	p.Vars = make(map[string]*ValueSource, len(decls))
+	p.Locals = make(map[string]*ValueSource, len(locals))
+
+	var userVars map[string]bool
+	if userCtx != nil {
+		userVars = make(map[string]bool, len(userCtx.Variables))
+		for name := range userCtx.Variables {
+			userVars[name] = true
+		}
+	}
+	exprSource := func(rng hcl.Range, expr hcl.Expression) *ValueSource {
+		return &ValueSource{
+			Kind:       exprSourceKind(expr, userVars),
+			Range:      rng,
+			Traversals: expr.Variables(),
+		}
+	}
+
+	for name, decl := range decls {
+		if ov, ok := overrides[name]; ok {
+			p.Vars[name] = &ValueSource{Kind: ov.kind, Range: ov.rng, Detail: ov.source}
+			continue
+		}
+		if decl.defaultAttr != nil {
+			src := exprSource(decl.defaultAttr.Range, decl.defaultAttr.Expr)
+			src.Kind = SourceVarDefault
+			p.Vars[name] = src
+		}
+	}
+	for name, attr := range locals {
+		p.Locals[name] = exprSource(attr.Range, attr.Expr)
+	}
+	p.recordBody("", body, rt, exprSource)
+}
+
+// recordBody records the attributes and blocks of body that decode into the
+// struct type rt, prefixing field paths with prefix.
+func (p *Provenance) recordBody(prefix string, body hcl.Body, rt reflect.Type, exprSource func(hcl.Range, hcl.Expression) *ValueSource) {
+	schema, _ := gohcl.ImpliedBodySchema(reflect.New(rt).Interface())
+	content, _, _ := body.PartialContent(schema)
+	if content == nil {
+		return
+	}
+	blocksByType := content.Blocks.ByType()
+
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		tag := field.Tag.Get("hcl")
+		if tag == "" {
+			continue
+		}
+		name, kind := parseHCLTag(tag)
+		path := field.Name
+		if prefix != "" {
+			path = prefix + "." + field.Name
+		}
+
+		switch kind {
+		case "attr", "optional":
+			if attr, ok := content.Attributes[name]; ok {
+				p.Fields[path] = exprSource(attr.Range, attr.Expr)
+			} else if text, ok := field.Tag.Lookup(defaultTag); ok {
+				p.Fields[path] = &ValueSource{
+					Kind:   SourceTagDefault,
+					Range:  body.MissingItemRange(),
+					Detail: fmt.Sprintf("default tag %q", text),
+				}
+			}
+		case "block":
+			ft := field.Type
+			isSlice := ft.Kind() == reflect.Slice
+			if isSlice {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			for j, block := range blocksByType[name] {
+				blockPath := path
+				if isSlice {
+					blockPath = fmt.Sprintf("%s[%d]", path, j)
+				} else if j > 0 {
+					break
+				}
+				p.recordLabels(blockPath, block, ft)
+				p.recordBody(blockPath, block.Body, ft, exprSource)
+			}
+		}
+	}
+}
+
+// recordLabels records the label fields of a block decoded into rt.
+func (p *Provenance) recordLabels(prefix string, block *hcl.Block, rt reflect.Type) {
+	labelIdx := 0
+	for i := 0; i < rt.NumField() && labelIdx < len(block.Labels); i++ {
+		field := rt.Field(i)
+		if _, kind := parseHCLTag(field.Tag.Get("hcl")); kind == "label" {
+			p.Fields[prefix+"."+field.Name] = &ValueSource{
+				Kind:  SourceLiteral,
+				Range: block.LabelRanges[labelIdx],
+			}
+			labelIdx++
+		}
+	}
+}
+
+// envFunctionNames are the built-in functions that read the environment.
+var envFunctionNames = map[string]bool{
+	"env":          true,
+	"required_env": true,
+	"env_int":      true,
+	"env_bool":     true,
+}
+
+// exprSourceKind classifies an expression by what it reads from. userVars
+// are the variable names supplied through WithEvalContext.
+func exprSourceKind(expr hcl.Expression, userVars map[string]bool) SourceKind {
+	traversals := expr.Variables()
+	for _, t := range traversals {
+		if userVars[t.RootName()] {
+			return SourceEvalContext
+		}
+	}
+	if syntaxExpr, ok := expr.(hclsyntax.Expression); ok {
+		callsEnv := false
+		hclsyntax.VisitAll(syntaxExpr, func(node hclsyntax.Node) hcl.Diagnostics {
+			if call, ok := node.(*hclsyntax.FunctionCallExpr); ok && envFunctionNames[call.Name] {
+				callsEnv = true
+			}
+			return nil
+		})
+		if callsEnv {
+			return SourceEnv
+		}
+	}
+	if len(traversals) > 0 {
+		return SourceReference
+	}
+	return SourceLiteral
+}
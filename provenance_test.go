@@ -0,0 +1,155 @@
+package hclconfig
+
+import (
+	"testing"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestLoad_Provenance(t *testing.T) {
+	t.Setenv("TEST_PROVENANCE_DB_HOST", "env.example.com")
+	t.Setenv("TEST_PROVENANCE_port", "6543")
+	src := []byte(`
+var "port" {
+    default = 5432
+}
+var "scheme" {
+    default = "postgres"
+}
+database {
+    host = env("TEST_PROVENANCE_DB_HOST")
+    port = var.port
+}
+app {
+    db_url = "${var.scheme}://${database.host}:${database.port}/${db_name}"
+}
+`)
+	ctx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{"db_name": cty.StringVal("mydb")},
+	}
+	var cfg CrossRefConfig
+	var prov Provenance
+	err := Load(src, "test.hcl", &cfg, WithProvenance(&prov), WithEvalContext(ctx), WithVarsFromEnv("TEST_PROVENANCE_"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path string
+		kind SourceKind
+		line int
+		refs int
+	}{
+		{"Database.Host", SourceEnv, 9, 0},
+		{"Database.Port", SourceReference, 10, 1},
+		{"App.DBUrl", SourceEvalContext, 13, 4},
+	}
+	for _, tt := range tests {
+		src, ok := prov.Fields[tt.path]
+		if !ok {
+			t.Errorf("no provenance for %s", tt.path)
+			continue
+		}
+		if src.Kind != tt.kind {
+			t.Errorf("%s: kind = %s, want %s", tt.path, src.Kind, tt.kind)
+		}
+		if src.Range.Filename != "test.hcl" || src.Range.Start.Line != tt.line {
+			t.Errorf("%s: range = %s, want test.hcl line %d", tt.path, src.Range, tt.line)
+		}
+		if len(src.Traversals) != tt.refs {
+			t.Errorf("%s: %d traversals, want %d", tt.path, len(src.Traversals), tt.refs)
+		}
+	}
+
+	if got := prov.Vars["port"]; got == nil || got.Kind != SourceEnv || got.Detail != "environment variable TEST_PROVENANCE_port" {
+		t.Errorf("var.port provenance = %+v", got)
+	}
+	if got := prov.Vars["scheme"]; got == nil || got.Kind != SourceVarDefault || got.Range.Start.Line != 6 {
+		t.Errorf("var.scheme provenance = %+v", got)
+	}
+}
+
+func TestLoad_Provenance_LabeledAndNested(t *testing.T) {
+	src := []byte(`
+service "api" {
+    host = "api.example.com"
+    port = 8080
+}
+service "web" {
+    host = "web.example.com"
+    port = 80
+}
+`)
+	type Config struct {
+		Services []ServiceConfig `hcl:"service,block"`
+	}
+	var cfg Config
+	var prov Provenance
+	if err := Load(src, "test.hcl", &cfg, WithProvenance(&prov)); err != nil {
+		t.Fatal(err)
+	}
+	if got := prov.Fields["Services[1].Port"]; got == nil || got.Kind != SourceLiteral || got.Range.Start.Line != 8 {
+		t.Errorf("Services[1].Port provenance = %+v", got)
+	}
+	if got := prov.Fields["Services[1].Name"]; got == nil || got.Range.Start.Line != 6 {
+		t.Errorf("Services[1].Name provenance = %+v", got)
+	}
+
+	src = []byte(`
+database {
+    host = "localhost"
+    port = 5432
+    credentials {
+        username = "admin"
+        password = database.host
+    }
+}
+app {
+    conn_string = "postgres://${database.credentials.username}@${database.host}"
+}
+`)
+	var nested NestedConfig
+	prov = Provenance{}
+	if err := Load(src, "test.hcl", &nested, WithProvenance(&prov)); err != nil {
+		t.Fatal(err)
+	}
+	if got := prov.Fields["Database.Credentials.Password"]; got == nil || got.Kind != SourceReference || got.Range.Start.Line != 7 {
+		t.Errorf("Database.Credentials.Password provenance = %+v", got)
+	}
+}
+
+func TestLoad_Provenance_TagDefaults(t *testing.T) {
+	src := []byte(`
+app {
+    db_url = "postgres://${database.host}:${database.port}"
+    pool {}
+}
+database {
+    host = "localhost"
+}
+`)
+	var cfg DefaultsConfig
+	var prov Provenance
+	if err := Load(src, "test.hcl", &cfg, WithProvenance(&prov)); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path   string
+		line   int
+		detail string
+	}{
+		{"Timeout", 1, `default tag "30"`},
+		{"Database.Port", 6, `default tag "5432"`},
+		{"App.Pool.Size", 4, `default tag "10"`},
+	}
+	for _, tt := range tests {
+		got := prov.Fields[tt.path]
+		if got == nil || got.Kind != SourceTagDefault || got.Detail != tt.detail || got.Range.Start.Line != tt.line {
+			t.Errorf("%s provenance = %+v, want %s on line %d", tt.path, got, tt.detail, tt.line)
+		}
+	}
+	if got := prov.Fields["Database.Host"]; got == nil || got.Kind != SourceLiteral {
+		t.Errorf("Database.Host provenance = %+v", got)
+	}
+}
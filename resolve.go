@@ -1,124 +1,371 @@
 package hclconfig
 
 import (
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strings"
+
 	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
 )
 
-// blockInfo holds metadata about a block or top-level attribute for dependency analysis.
+// blockInfo identifies a node in the dependency graph: a whole block, a single
+// attribute or nested block type within a block, a var block or a top-level
+// attribute.
 type blockInfo struct {
 	typeName string
-	label    string // empty for unlabeled blocks and attributes
-	index    int    // position in the original block list
-	isAttr   bool   // true if this represents a top-level attribute
+	labels   []string // block labels, or the name of a var or local; empty for unlabeled blocks and attributes
+	member   string   // attribute or nested block type within the block; empty for the block itself
+	index    int      // position in the original block list
+	elem     int      // position among the blocks of its type, when repeated
+	repeated bool     // true for unlabeled blocks decoded into a slice, referenced by index
+	isAttr   bool     // true if this represents a top-level attribute
+	isVar    bool     // true for var blocks, which resolve as a single node
+	isLocal  bool     // true for a local value; labels holds its name
 }
 
-func (b blockInfo) key() string {
-	if b.label != "" {
-		return b.typeName + "." + b.label
-	}
-	return b.typeName
+// label returns the node's labels joined with dots, e.g. "aws_instance.web".
+func (b blockInfo) label() string {
+	return strings.Join(b.labels, ".")
 }
 
-// buildDependencyGraph analyzes blocks and top-level attributes, returning a
-// map of node key -> set of node keys it depends on.
-func buildDependencyGraph(blocks []*hcl.Block, blockInfos []blockInfo, attrs map[string]*hcl.Attribute) map[string]map[string]bool {
-	// Build set of known names (block types + attribute names)
-	knownTypes := make(map[string]bool)
-	for _, bi := range blockInfos {
-		knownTypes[bi.typeName] = true
+// blockKey returns the key of the block the node belongs to, e.g.
+// "service.api" for both the block and its "service.api.port" attribute, or
+// "listener[0]" for the first of several unlabeled listener blocks.
+func (b blockInfo) blockKey() string {
+	if b.repeated {
+		return fmt.Sprintf("%s[%d]", b.typeName, b.elem)
 	}
-	for name := range attrs {
-		knownTypes[name] = true
+	if len(b.labels) > 0 {
+		return b.typeName + "." + b.label()
 	}
+	return b.typeName
+}
 
-	// Combine block and attribute infos for labeled-block lookups in addDependency
-	var allInfos []blockInfo
-	allInfos = append(allInfos, blockInfos...)
-	for name := range attrs {
-		allInfos = append(allInfos, blockInfo{typeName: name, isAttr: true})
+func (b blockInfo) key() string {
+	if b.member != "" {
+		return b.blockKey() + "." + b.member
 	}
+	return b.blockKey()
+}
 
-	deps := make(map[string]map[string]bool)
+// buildDependencyGraph analyzes blocks, local values and top-level attributes
+// at attribute granularity. Every attribute and nested block type of a user
+// block becomes its own node, and the block itself becomes a node that depends
+// on all of them. It returns every node together with a map of node key -> set
+// of node keys it depends on, and reports references to repeated blocks by an
+// index that is out of range.
+func buildDependencyGraph(blocks []*hcl.Block, blockInfos []blockInfo, attrs, locals map[string]*hcl.Attribute) ([]blockInfo, map[string]map[string]bool, hcl.Diagnostics) {
+	var nodes []blockInfo
+	traversals := make(map[string][]hcl.Traversal)
 
-	// Analyze block dependencies
 	for i, block := range blocks {
 		bi := blockInfos[i]
-		key := bi.key()
+		nodes = append(nodes, bi)
+		if bi.isVar {
+			for _, m := range bodyMembers(block.Body) {
+				// Type constraints such as list(string) are keywords, not
+				// references.
+				if m.name != "type" {
+					traversals[bi.key()] = append(traversals[bi.key()], m.traversals...)
+				}
+			}
+			continue
+		}
+		for _, m := range bodyMembers(block.Body) {
+			mi := bi
+			mi.member = m.name
+			nodes = append(nodes, mi)
+			traversals[mi.key()] = append(traversals[mi.key()], m.traversals...)
+		}
+	}
+	for _, attr := range sortedAttributes(locals) {
+		bi := blockInfo{typeName: "local", labels: []string{attr.Name}, isLocal: true}
+		nodes = append(nodes, bi)
+		traversals[bi.key()] = attr.Expr.Variables()
+	}
+	for _, attr := range sortedAttributes(attrs) {
+		bi := blockInfo{typeName: attr.Name, isAttr: true}
+		nodes = append(nodes, bi)
+		traversals[bi.key()] = attr.Expr.Variables()
+	}
+
+	g := newGraphIndex(nodes)
+	deps := make(map[string]map[string]bool)
+	for _, n := range nodes {
+		key := n.key()
 		if deps[key] == nil {
 			deps[key] = make(map[string]bool)
 		}
-
-		bodyAttrs, _ := block.Body.JustAttributes()
-		for _, attr := range bodyAttrs {
-			for _, traversal := range attr.Expr.Variables() {
-				addDependency(deps, key, traversal, knownTypes, allInfos)
-			}
+		if n.member != "" {
+			// A block is complete once all of its members are.
+			deps[n.blockKey()][key] = true
+		}
+	}
+	var diags hcl.Diagnostics
+	for _, n := range nodes {
+		for _, traversal := range traversals[n.key()] {
+			diags = append(diags, addDependency(deps, n, traversal, g)...)
 		}
+	}
+
+	return nodes, deps, diags
+}
+
+// graphIndex provides the lookups addDependency needs to map a traversal to
+// the nodes it refers to.
+type graphIndex struct {
+	keys   map[string]bool
+	attrs  map[string]bool
+	byType map[string][]blockInfo // block-level nodes by block type
+}
 
-		if syntaxBody, ok := block.Body.(*hclsyntax.Body); ok {
-			extractNestedBlockDeps(deps, key, syntaxBody.Blocks, knownTypes, allInfos)
+func newGraphIndex(nodes []blockInfo) graphIndex {
+	g := graphIndex{
+		keys:   make(map[string]bool),
+		attrs:  make(map[string]bool),
+		byType: make(map[string][]blockInfo),
+	}
+	for _, n := range nodes {
+		g.keys[n.key()] = true
+		switch {
+		case n.isAttr:
+			g.attrs[n.typeName] = true
+		case n.member == "":
+			g.byType[n.typeName] = append(g.byType[n.typeName], n)
 		}
 	}
+	return g
+}
+
+// targets returns the keys of the nodes a traversal refers to: the most
+// specific attribute node when one exists, otherwise the whole block, or every
+// block of the type when no particular block is selected. A reference to a
+// repeated block by an index out of range is reported instead.
+func (g graphIndex) targets(traversal hcl.Traversal) ([]string, *hcl.Diagnostic) {
+	root := traversal.RootName()
+	if g.attrs[root] {
+		return []string{root}, nil
+	}
+	instances := g.byType[root]
+	if len(instances) == 0 {
+		return nil, nil
+	}
 
-	// Analyze top-level attribute dependencies
-	for name, attr := range attrs {
-		if deps[name] == nil {
-			deps[name] = make(map[string]bool)
+	// Narrow the instances down one label at a time, so that
+	// resource.aws_instance.web selects a single block while
+	// resource.aws_instance selects every block with that first label.
+	// Repeated blocks are selected by index instead, e.g. listener[0].
+	matches := instances
+	step := 1
+	if instances[0].repeated {
+		idx, ok := traverseIndex(traversal, step)
+		if !ok {
+			return blockKeys(instances), nil
+		}
+		if idx < 0 || idx >= len(instances) {
+			key := traversal[step].(hcl.TraverseIndex).Key.AsBigFloat().Text('f', -1)
+			return nil, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid block index",
+				Detail:   fmt.Sprintf("There is no %s block at index %s; %s.", root, key, countBlocks(root, len(instances))),
+				Subject:  traversal.SourceRange().Ptr(),
+			}
+		}
+		matches = instances[idx : idx+1]
+		step++
+	}
+	for depth := range instances[0].labels {
+		name, ok := traverseName(traversal, step)
+		var next []blockInfo
+		for _, bi := range matches {
+			if ok && depth < len(bi.labels) && bi.labels[depth] == name {
+				next = append(next, bi)
+			}
+		}
+		if len(next) == 0 {
+			return blockKeys(matches), nil
 		}
-		for _, traversal := range attr.Expr.Variables() {
-			addDependency(deps, name, traversal, knownTypes, allInfos)
+		matches = next
+		step++
+	}
+	target := matches[0]
+	if target.isVar || target.isLocal {
+		return []string{target.key()}, nil
+	}
+	if name, ok := traverseName(traversal, step); ok {
+		if key := target.blockKey() + "." + name; g.keys[key] {
+			return []string{key}, nil
 		}
 	}
+	return []string{target.blockKey()}, nil
+}
 
-	return deps
+// blockKeys returns the keys of nodes.
+func blockKeys(nodes []blockInfo) []string {
+	keys := make([]string, len(nodes))
+	for i, bi := range nodes {
+		keys[i] = bi.key()
+	}
+	return keys
 }
 
-func extractNestedBlockDeps(deps map[string]map[string]bool, parentKey string, blocks []*hclsyntax.Block, knownTypes map[string]bool, blockInfos []blockInfo) {
-	for _, block := range blocks {
-		attrs, _ := block.Body.JustAttributes()
-		for _, attr := range attrs {
-			for _, traversal := range attr.Expr.Variables() {
-				addDependency(deps, parentKey, traversal, knownTypes, blockInfos)
-			}
+// countBlocks describes how many blocks of a repeated type there are and
+// which indexes are valid.
+func countBlocks(typeName string, n int) string {
+	if n == 1 {
+		return fmt.Sprintf("there is 1 %s block, at index 0", typeName)
+	}
+	return fmt.Sprintf("there are %d %s blocks, at indexes 0 to %d", n, typeName, n-1)
+}
+
+// traverseName returns the attribute name or string index at position i of a
+// traversal, e.g. "api" for both service.api and service["api"].
+func traverseName(traversal hcl.Traversal, i int) (string, bool) {
+	if i >= len(traversal) {
+		return "", false
+	}
+	switch step := traversal[i].(type) {
+	case hcl.TraverseAttr:
+		return step.Name, true
+	case hcl.TraverseIndex:
+		if step.Key.Type() == cty.String && step.Key.IsKnown() && !step.Key.IsNull() {
+			return step.Key.AsString(), true
 		}
-		// Recurse into deeper nested blocks
-		extractNestedBlockDeps(deps, parentKey, block.Body.Blocks, knownTypes, blockInfos)
 	}
+	return "", false
 }
 
-func addDependency(deps map[string]map[string]bool, fromKey string, traversal hcl.Traversal, knownTypes map[string]bool, blockInfos []blockInfo) {
-	if len(traversal) == 0 {
-		return
+// traverseIndex returns the number index at position i of a traversal, e.g.
+// 0 for listener[0], or -1 when the number is not whole.
+func traverseIndex(traversal hcl.Traversal, i int) (int, bool) {
+	if i >= len(traversal) {
+		return 0, false
+	}
+	step, ok := traversal[i].(hcl.TraverseIndex)
+	if !ok || step.Key.Type() != cty.Number || !step.Key.IsKnown() || step.Key.IsNull() {
+		return 0, false
 	}
+	bf := step.Key.AsBigFloat()
+	if n, acc := bf.Int64(); acc == big.Exact && n <= math.MaxInt32 {
+		return int(n), true
+	}
+	return -1, true
+}
 
-	root := traversal.RootName()
-	if !knownTypes[root] {
-		return
-	}
-
-	// Check if it references a specific label: e.g. service.api.port
-	// The traversal would be: root="service", then GetAttr "api", then GetAttr "port"
-	targetKey := root
-	if len(traversal) > 1 {
-		if attr, ok := traversal[1].(hcl.TraverseAttr); ok {
-			// Check if there's a labeled block with this label
-			for _, bi := range blockInfos {
-				if bi.typeName == root && bi.label == attr.Name {
-					targetKey = bi.key()
-					break
-				}
+// bodyMember is an attribute or nested block type of a block body together
+// with the variable references made within it.
+type bodyMember struct {
+	name       string
+	traversals []hcl.Traversal
+}
+
+// bodyMembers splits body into its attributes and nested block types in
+// source order.
+func bodyMembers(body hcl.Body) []bodyMember {
+	var members []bodyMember
+
+	if syntaxBody, ok := body.(*hclsyntax.Body); ok {
+		attrs := make(hcl.Attributes, len(syntaxBody.Attributes))
+		for name, attr := range syntaxBody.Attributes {
+			attrs[name] = attr.AsHCLAttribute()
+		}
+		for _, attr := range sortedAttributes(attrs) {
+			members = append(members, bodyMember{name: attr.Name, traversals: attr.Expr.Variables()})
+		}
+		index := make(map[string]int)
+		for _, block := range syntaxBody.Blocks {
+			i, ok := index[block.Type]
+			if !ok {
+				i = len(members)
+				index[block.Type] = i
+				members = append(members, bodyMember{name: block.Type})
 			}
+			members[i].traversals = append(members[i].traversals, bodyTraversals(block.Body)...)
 		}
+		return members
 	}
 
-	// Don't add self-dependency
-	if targetKey != fromKey {
-		if deps[fromKey] == nil {
-			deps[fromKey] = make(map[string]bool)
+	// JSON bodies cannot tell nested blocks from object-valued attributes
+	// without a schema, so every property comes back as an attribute. Their
+	// Variables() recurse into nested objects and arrays, which covers
+	// references made inside nested blocks.
+	attrs, _ := body.JustAttributes()
+	for _, attr := range sortedAttributes(attrs) {
+		members = append(members, bodyMember{name: attr.Name, traversals: attr.Expr.Variables()})
+	}
+	return members
+}
+
+// bodyTraversals returns every variable reference made in body, including
+// references inside nested blocks at any depth.
+func bodyTraversals(body hcl.Body) []hcl.Traversal {
+	var traversals []hcl.Traversal
+	for _, m := range bodyMembers(body) {
+		traversals = append(traversals, m.traversals...)
+	}
+	return traversals
+}
+
+// sortedAttributes returns attrs ordered by their position in the source.
+func sortedAttributes(attrs hcl.Attributes) []*hcl.Attribute {
+	sorted := make([]*hcl.Attribute, 0, len(attrs))
+	for _, attr := range attrs {
+		sorted = append(sorted, attr)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i].Range, sorted[j].Range
+		if a.Filename != b.Filename {
+			return a.Filename < b.Filename
+		}
+		return a.Start.Byte < b.Start.Byte
+	})
+	return sorted
+}
+
+func addDependency(deps map[string]map[string]bool, from blockInfo, traversal hcl.Traversal, g graphIndex) hcl.Diagnostics {
+	if len(traversal) == 0 {
+		return nil
+	}
+	if traversal.RootName() == selfName && !from.isAttr && !from.isVar && !from.isLocal {
+		traversal = resolveSelf(traversal, from)
+	}
+
+	targets, diag := g.targets(traversal)
+	if diag != nil {
+		return hcl.Diagnostics{diag}
+	}
+	fromKey := from.key()
+	for _, targetKey := range targets {
+		// Don't add self-dependency, including on the enclosing block, which
+		// cannot be complete before this member is.
+		if targetKey == fromKey || targetKey == from.blockKey() {
+			continue
 		}
 		deps[fromKey][targetKey] = true
 	}
+	return nil
+}
+
+// selfName is the variable through which expressions within a block refer
+// to the block itself, e.g. self.cert_dir.
+const selfName = "self"
+
+// resolveSelf rewrites a reference to self made within the block of b as the
+// equivalent reference by block type and labels, e.g. self.port within
+// service "api" as service.api.port.
+func resolveSelf(traversal hcl.Traversal, b blockInfo) hcl.Traversal {
+	resolved := hcl.Traversal{hcl.TraverseRoot{Name: b.typeName, SrcRange: traversal.SourceRange()}}
+	if b.repeated {
+		resolved = append(resolved, hcl.TraverseIndex{Key: cty.NumberIntVal(int64(b.elem)), SrcRange: traversal.SourceRange()})
+	}
+	for _, label := range b.labels {
+		resolved = append(resolved, hcl.TraverseAttr{Name: label})
+	}
+	return append(resolved, traversal[1:]...)
 }
 
 // topoSort performs a topological sort using Kahn's algorithm.
@@ -203,14 +450,11 @@ func findCycle(keys []string, deps map[string]map[string]bool) []string {
 		visited[node] = 1
 		for dep := range deps[node] {
 			if visited[dep] == 1 {
-				// Found cycle — reconstruct
-				cycle = []string{dep, node}
+				// Found cycle — reconstruct by walking back from node to dep
+				cycle = []string{node}
 				cur := node
 				for cur != dep {
 					cur = parent[cur]
-					if cur == dep {
-						break
-					}
 					cycle = append(cycle, cur)
 				}
 				// Reverse and add closing node
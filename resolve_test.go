@@ -112,20 +112,23 @@ app {
 		{typeName: "app", index: 1},
 	}
 
-	deps := buildDependencyGraph(content.Blocks, infos, nil)
+	_, deps, _ := buildDependencyGraph(content.Blocks, infos, nil, nil)
 
-	if !deps["app"]["database"] {
-		t.Errorf("expected app to depend on database, got: %v", deps["app"])
+	if !deps["app.db_url"]["database.host"] || !deps["app.db_url"]["database.port"] {
+		t.Errorf("expected app.db_url to depend on database.host and database.port, got: %v", deps["app.db_url"])
 	}
-	if len(deps["database"]) != 0 {
-		t.Errorf("expected database to have no deps, got: %v", deps["database"])
+	if !deps["app"]["app.db_url"] {
+		t.Errorf("expected app to depend on its attribute app.db_url, got: %v", deps["app"])
+	}
+	if len(deps["database.host"]) != 0 {
+		t.Errorf("expected database.host to have no deps, got: %v", deps["database.host"])
 	}
 }
 
 func TestTopoSort_LabeledBlocks(t *testing.T) {
 	infos := []blockInfo{
-		{typeName: "service", label: "api", index: 0},
-		{typeName: "service", label: "web", index: 1},
+		{typeName: "service", labels: []string{"api"}, index: 0},
+		{typeName: "service", labels: []string{"web"}, index: 1},
 		{typeName: "app", index: 2},
 	}
 	deps := map[string]map[string]bool{
@@ -155,3 +158,47 @@ func TestTopoSort_LabeledBlocks(t *testing.T) {
 		t.Error("service.web should come before app")
 	}
 }
+
+func TestBuildDependencyGraph_IndexedBlocks(t *testing.T) {
+	src := `
+listener {
+    port = 80
+}
+listener {
+    port = listener[0].port + 1
+    tls  = self.port
+}
+app {
+    all = listener
+}
+`
+	file, diags := hclparse.NewParser().ParseHCL([]byte(src), "test.hcl")
+	if diags.HasErrors() {
+		t.Fatal(diags.Error())
+	}
+	content, _, diags := file.Body.PartialContent(&hcl.BodySchema{
+		Blocks: []hcl.BlockHeaderSchema{{Type: "listener"}, {Type: "app"}},
+	})
+	if diags.HasErrors() {
+		t.Fatal(diags.Error())
+	}
+	infos := []blockInfo{
+		{typeName: "listener", index: 0, repeated: true, elem: 0},
+		{typeName: "listener", index: 1, repeated: true, elem: 1},
+		{typeName: "app", index: 2},
+	}
+
+	_, deps, diags := buildDependencyGraph(content.Blocks, infos, nil, nil)
+	if diags.HasErrors() {
+		t.Fatal(diags.Error())
+	}
+	if got := deps["listener[1].port"]; len(got) != 1 || !got["listener[0].port"] {
+		t.Errorf("expected listener[1].port to depend on listener[0].port only, got: %v", got)
+	}
+	if got := deps["listener[1].tls"]; len(got) != 1 || !got["listener[1].port"] {
+		t.Errorf("expected listener[1].tls to depend on listener[1].port, got: %v", got)
+	}
+	if got := deps["app.all"]; !got["listener[0]"] || !got["listener[1]"] {
+		t.Errorf("expected app.all to depend on every listener, got: %v", got)
+	}
+}
@@ -0,0 +1,3 @@
+app {
+    db_url = "postgres://${database.host}:${database.port}/mydb"
+}
@@ -0,0 +1,4 @@
+database {
+    host = var.db_host
+    port = 5432
+}
@@ -0,0 +1,3 @@
+var "db_host" {
+  default = "db.internal"
+}
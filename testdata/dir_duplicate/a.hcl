@@ -0,0 +1,4 @@
+database {
+    host = "a.internal"
+    port = 5432
+}
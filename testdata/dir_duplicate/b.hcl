@@ -0,0 +1,4 @@
+database {
+    host = "b.internal"
+    port = 5432
+}
@@ -0,0 +1,5 @@
+tls {
+  cert     = file("cert.pem")
+  has_key  = fileexists("key.pem")
+  greeting = templatefile("greeting.tpl", { name = upper("ops"), count = 3 })
+}
@@ -0,0 +1 @@
+Hello, ${name}! You have %{ if count > 0 }${count}%{ else }no%{ endif } messages.
\ No newline at end of file
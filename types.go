@@ -0,0 +1,265 @@
+package hclconfig
+
+import (
+	"encoding"
+	"fmt"
+	"math"
+	"math/big"
+	"net"
+	"net/netip"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+)
+
+// TypeDecoder converts an attribute value into a value of the field type it
+// is registered for.
+type TypeDecoder func(cty.Value) (reflect.Value, error)
+
+// WithTypeDecoder registers dec for fields of type t, in blocks and at the
+// top level alike, replacing any built-in decoder for t. Built-in decoders
+// cover time.Duration ("30s"), time.Time (RFC 3339), ByteSize ("512MiB"),
+// net.IP, netip.Prefix, *url.URL, *regexp.Regexp and any type implementing
+// encoding.TextUnmarshaler.
+//
+// References to decoded fields see the built-in types as the strings they
+// were written as, and other types as the text of their MarshalText method
+// if they have one. Register a TypeEncoder with WithTypeEncoder for types
+// that have neither.
+func WithTypeDecoder(t reflect.Type, dec TypeDecoder) Option {
+	return func(o *options) {
+		if o.decoders == nil {
+			o.decoders = make(typeDecoders)
+		}
+		o.decoders[t] = dec
+	}
+}
+
+// TypeEncoder converts a field value back into the attribute value it was
+// decoded from. It is the reverse of a TypeDecoder.
+type TypeEncoder func(reflect.Value) (cty.Value, error)
+
+// WithTypeEncoder registers enc for values of type t, replacing any built-in
+// encoder and MarshalText method. The encoded value is what references to
+// fields of type t see, and what Encode and Rewrite write.
+func WithTypeEncoder(t reflect.Type, enc TypeEncoder) Option {
+	return func(o *options) {
+		if o.encoders == nil {
+			o.encoders = make(typeEncoders)
+		}
+		o.encoders[t] = enc
+	}
+}
+
+// typeDecoders holds the decoders registered with WithTypeDecoder.
+type typeDecoders map[reflect.Type]TypeDecoder
+
+// typeEncoders holds the encoders registered with WithTypeEncoder.
+type typeEncoders map[reflect.Type]TypeEncoder
+
+var (
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// lookup returns the decoder for fields of type t: a registered one, a
+// built-in one, or one calling UnmarshalText.
+func (d typeDecoders) lookup(t reflect.Type) (TypeDecoder, bool) {
+	if dec, ok := d[t]; ok {
+		return dec, true
+	}
+	if dec, ok := builtinDecoders[t]; ok {
+		return dec, true
+	}
+	if t.Kind() != reflect.Ptr && t != bigIntType && t != bigFloatType && reflect.PointerTo(t).Implements(textUnmarshalerType) {
+		return func(val cty.Value) (reflect.Value, error) {
+			ptr := reflect.New(t)
+			if val.Type() == cty.Number && isNumberType(t) {
+				err := setNumber(ptr.Elem(), val)
+				return ptr.Elem(), err
+			}
+			s, err := ctyString(val)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			if err := ptr.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s)); err != nil {
+				return reflect.Value{}, err
+			}
+			return ptr.Elem(), nil
+		}, true
+	}
+	return nil, false
+}
+
+// decodeWith sets fieldVal to the value dec decodes from val.
+func decodeWith(dec TypeDecoder, fieldVal reflect.Value, val cty.Value) error {
+	rv, err := dec(val)
+	if err != nil {
+		return err
+	}
+	if !rv.IsValid() || !rv.Type().AssignableTo(fieldVal.Type()) {
+		return fmt.Errorf("decoder for %s returned %s", fieldVal.Type(), rv.Type())
+	}
+	fieldVal.Set(rv)
+	return nil
+}
+
+// ctyString returns val converted to a string.
+func ctyString(val cty.Value) (string, error) {
+	s, err := convert.Convert(val, cty.String)
+	if err != nil {
+		return "", err
+	}
+	return s.AsString(), nil
+}
+
+// stringDecoder returns a TypeDecoder that parses string values with parse.
+func stringDecoder[T any](parse func(string) (T, error)) TypeDecoder {
+	return func(val cty.Value) (reflect.Value, error) {
+		s, err := ctyString(val)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		v, err := parse(s)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		return reflect.ValueOf(v), nil
+	}
+}
+
+var builtinDecoders = map[reflect.Type]TypeDecoder{
+	reflect.TypeOf(time.Duration(0)): func(val cty.Value) (reflect.Value, error) {
+		// Numbers are taken as nanoseconds, as gohcl did.
+		if val.Type() == cty.Number {
+			var d time.Duration
+			err := setNumber(reflect.ValueOf(&d).Elem(), val)
+			return reflect.ValueOf(d), err
+		}
+		return stringDecoder(time.ParseDuration)(val)
+	},
+	reflect.TypeOf(time.Time{}): stringDecoder(func(s string) (time.Time, error) {
+		return time.Parse(time.RFC3339, s)
+	}),
+	reflect.TypeOf(net.IP(nil)): stringDecoder(func(s string) (net.IP, error) {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IP address %q", s)
+		}
+		return ip, nil
+	}),
+	reflect.TypeOf(netip.Prefix{}):        stringDecoder(netip.ParsePrefix),
+	reflect.TypeOf((*url.URL)(nil)):       stringDecoder(url.Parse),
+	reflect.TypeOf((*regexp.Regexp)(nil)): stringDecoder(regexp.Compile),
+}
+
+// builtinEncoders convert values of the types with built-in decoders that do
+// not implement encoding.TextMarshaler back to the strings they decode from.
+var builtinEncoders = map[reflect.Type]func(reflect.Value) string{
+	reflect.TypeOf(time.Duration(0)): func(rv reflect.Value) string {
+		return time.Duration(rv.Int()).String()
+	},
+	reflect.TypeOf(url.URL{}): func(rv reflect.Value) string {
+		u := rv.Interface().(url.URL)
+		return u.String()
+	},
+}
+
+// encodeText returns the value a value of a type with an encoder, built-in
+// or registered, or a MarshalText method is referenced as, reporting false
+// for other types.
+func encodeText(rv reflect.Value, encoders typeEncoders) (cty.Value, bool, error) {
+	if enc, ok := encoders[rv.Type()]; ok {
+		val, err := enc(rv)
+		return val, true, err
+	}
+	if enc, ok := builtinEncoders[rv.Type()]; ok {
+		return cty.StringVal(enc(rv)), true, nil
+	}
+	if !rv.Type().Implements(textMarshalerType) {
+		if !reflect.PointerTo(rv.Type()).Implements(textMarshalerType) {
+			return cty.NilVal, false, nil
+		}
+		ptr := reflect.New(rv.Type())
+		ptr.Elem().Set(rv)
+		rv = ptr
+	}
+	text, err := rv.Interface().(encoding.TextMarshaler).MarshalText()
+	if err != nil {
+		return cty.NilVal, true, err
+	}
+	return cty.StringVal(string(text)), true, nil
+}
+
+// ByteSize is a number of bytes, written in configuration as a number or as
+// a string with a unit such as "512MiB" or "1.5GB". KB, MB, GB, TB and PB are
+// powers of 1000; KiB, MiB, GiB, TiB and PiB are powers of 1024.
+type ByteSize int64
+
+var byteUnits = []struct {
+	name string
+	size int64
+}{
+	{"PiB", 1 << 50}, {"TiB", 1 << 40}, {"GiB", 1 << 30}, {"MiB", 1 << 20}, {"KiB", 1 << 10},
+	{"PB", 1e15}, {"TB", 1e12}, {"GB", 1e9}, {"MB", 1e6}, {"KB", 1e3},
+	{"B", 1},
+}
+
+// ParseByteSize parses a size such as "512MiB", "1.5 GB" or "100". Units are
+// case-insensitive.
+func ParseByteSize(s string) (ByteSize, error) {
+	text := strings.TrimSpace(s)
+	size := int64(1)
+	for _, unit := range byteUnits {
+		if len(text) >= len(unit.name) && strings.EqualFold(text[len(text)-len(unit.name):], unit.name) {
+			text = strings.TrimSpace(text[:len(text)-len(unit.name)])
+			size = unit.size
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(text, 64)
+	if err != nil || math.IsInf(n, 0) || math.IsNaN(n) {
+		return 0, fmt.Errorf("invalid byte size %q", s)
+	}
+	bf := new(big.Float).Mul(big.NewFloat(n), new(big.Float).SetInt64(size))
+	if !bf.IsInt() {
+		return 0, fmt.Errorf("invalid byte size %q: not a whole number of bytes", s)
+	}
+	i, acc := bf.Int64()
+	if acc != big.Exact || i < 0 {
+		return 0, fmt.Errorf("invalid byte size %q: out of range", s)
+	}
+	return ByteSize(i), nil
+}
+
+// String formats the size with the largest unit that divides it exactly,
+// preferring binary units, e.g. "512MiB" or "1500B".
+func (b ByteSize) String() string {
+	for _, unit := range byteUnits {
+		if unit.size > 1 && b != 0 && int64(b)%unit.size == 0 {
+			return fmt.Sprintf("%d%s", int64(b)/unit.size, unit.name)
+		}
+	}
+	return fmt.Sprintf("%dB", int64(b))
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (b ByteSize) MarshalText() ([]byte, error) {
+	return []byte(b.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (b *ByteSize) UnmarshalText(text []byte) error {
+	n, err := ParseByteSize(string(text))
+	if err != nil {
+		return err
+	}
+	*b = n
+	return nil
+}
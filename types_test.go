@@ -0,0 +1,232 @@
+package hclconfig
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+type Level int
+
+func (l *Level) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "debug":
+		*l = 0
+	case "info":
+		*l = 1
+	default:
+		return fmt.Errorf("unknown level %q", text)
+	}
+	return nil
+}
+
+func (l Level) MarshalText() ([]byte, error) {
+	return []byte([]string{"debug", "info"}[l]), nil
+}
+
+type TypedServer struct {
+	Timeout  time.Duration  `hcl:"timeout,attr"`
+	Idle     time.Duration  `hcl:"idle,optional" default:"5m"`
+	Limit    ByteSize       `hcl:"limit,attr"`
+	Started  time.Time      `hcl:"started,attr"`
+	Bind     net.IP         `hcl:"bind,attr"`
+	Network  netip.Prefix   `hcl:"network,attr"`
+	Endpoint *url.URL       `hcl:"endpoint,attr"`
+	Match    *regexp.Regexp `hcl:"match,attr"`
+	Level    Level          `hcl:"level,attr"`
+}
+
+type TypedConfig struct {
+	Timeout time.Duration `hcl:"timeout,attr"`
+	Server  TypedServer   `hcl:"server,block"`
+	Summary string        `hcl:"summary,attr"`
+}
+
+func TestLoad_TypeDecoders(t *testing.T) {
+	src := []byte(`
+timeout = "1m30s"
+server {
+    timeout  = timeout
+    limit    = "512MiB"
+    started  = "2024-05-01T12:00:00Z"
+    bind     = "10.0.0.1"
+    network  = "10.0.0.0/16"
+    endpoint = "https://example.com/api"
+    match    = "^web-[0-9]+$"
+    level    = "info"
+}
+summary = "${server.timeout} ${server.idle} ${server.limit} ${server.level} ${server.endpoint}"
+`)
+	var cfg TypedConfig
+	if err := Load(src, "test.hcl", &cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	s := cfg.Server
+	if cfg.Timeout != 90*time.Second || s.Timeout != 90*time.Second {
+		t.Errorf("Timeout = %v, %v", cfg.Timeout, s.Timeout)
+	}
+	if s.Idle != 5*time.Minute {
+		t.Errorf("Idle = %v", s.Idle)
+	}
+	if s.Limit != 512<<20 {
+		t.Errorf("Limit = %d", s.Limit)
+	}
+	if !s.Started.Equal(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("Started = %v", s.Started)
+	}
+	if !s.Bind.Equal(net.ParseIP("10.0.0.1")) {
+		t.Errorf("Bind = %v", s.Bind)
+	}
+	if s.Network != netip.MustParsePrefix("10.0.0.0/16") {
+		t.Errorf("Network = %v", s.Network)
+	}
+	if s.Endpoint == nil || s.Endpoint.Host != "example.com" {
+		t.Errorf("Endpoint = %v", s.Endpoint)
+	}
+	if s.Match == nil || !s.Match.MatchString("web-12") {
+		t.Errorf("Match = %v", s.Match)
+	}
+	if s.Level != 1 {
+		t.Errorf("Level = %v", s.Level)
+	}
+	if want := "1m30s 5m0s 512MiB info https://example.com/api"; cfg.Summary != want {
+		t.Errorf("Summary = %q, want %q", cfg.Summary, want)
+	}
+}
+
+func TestLoad_TypeDecoderErrors(t *testing.T) {
+	type config struct {
+		Timeout time.Duration `hcl:"timeout,attr"`
+		Limit   ByteSize      `hcl:"limit,attr"`
+		Level   Level         `hcl:"level,attr"`
+	}
+	var cfg config
+	err := Load([]byte("timeout = \"soon\"\nlimit = \"12XB\"\nlevel = \"loud\""), "test.hcl", &cfg)
+	if err == nil {
+		t.Fatal("expected decode errors")
+	}
+	msg := err.Error()
+	for _, want := range []string{
+		`test.hcl:1,11: Unsuitable value type: Attribute "timeout": time: invalid duration "soon"`,
+		`test.hcl:2,9: Unsuitable value type: Attribute "limit": invalid byte size "12XB"`,
+		`test.hcl:3,9: Unsuitable value type: Attribute "level": unknown level "loud"`,
+	} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("expected %q in error, got:\n%s", want, msg)
+		}
+	}
+}
+
+func TestLoad_WithTypeDecoder(t *testing.T) {
+	type celsius float64
+	type config struct {
+		Temp  celsius   `hcl:"temp,attr"`
+		Temps []celsius `hcl:"temps,attr"`
+	}
+	dec := func(val cty.Value) (reflect.Value, error) {
+		s, _ := ctyString(val)
+		var f float64
+		if _, err := fmt.Sscanf(s, "%fC", &f); err != nil {
+			return reflect.Value{}, fmt.Errorf("invalid temperature %q", s)
+		}
+		return reflect.ValueOf(celsius(f)), nil
+	}
+	var cfg config
+	err := Load([]byte("temp = \"21.5C\"\ntemps = [\"1C\", \"2C\"]"), "test.hcl", &cfg,
+		WithTypeDecoder(reflect.TypeOf(celsius(0)), dec))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Temp != 21.5 || len(cfg.Temps) != 2 || cfg.Temps[1] != 2 {
+		t.Errorf("cfg = %+v", cfg)
+	}
+}
+
+func TestLoad_WithTypeEncoder(t *testing.T) {
+	type point struct{ x, y int }
+	type sensor struct {
+		Pos point `hcl:"pos,attr"`
+	}
+	type config struct {
+		Sensor sensor `hcl:"sensor,block"`
+		Label  string `hcl:"label,attr"`
+	}
+	pointType := reflect.TypeOf(point{})
+	opts := []Option{
+		WithTypeDecoder(pointType, stringDecoder(func(s string) (point, error) {
+			var p point
+			_, err := fmt.Sscanf(s, "%d,%d", &p.x, &p.y)
+			return p, err
+		})),
+		WithTypeEncoder(pointType, func(rv reflect.Value) (cty.Value, error) {
+			p := rv.Interface().(point)
+			return cty.StringVal(fmt.Sprintf("%d,%d", p.x, p.y)), nil
+		}),
+	}
+	var cfg config
+	src := []byte(`
+sensor {
+    pos = "3,4"
+}
+label = "at ${sensor.pos}"
+`)
+	if err := Load(src, "test.hcl", &cfg, opts...); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Label != "at 3,4" {
+		t.Errorf("label = %q, want %q", cfg.Label, "at 3,4")
+	}
+
+	out, err := Encode(&cfg, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), `pos = "3,4"`) {
+		t.Errorf("expected encoded point, got:\n%s", out)
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		want ByteSize
+	}{
+		{"100", 100},
+		{"100B", 100},
+		{"1.5KB", 1500},
+		{"512MiB", 512 << 20},
+		{"2 gib", 2 << 30},
+		{"1TB", 1e12},
+	} {
+		got, err := ParseByteSize(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseByteSize(%q) = %d, %v; want %d", tt.in, got, err, tt.want)
+		}
+	}
+	for _, in := range []string{"", "MiB", "1.5B", "-1KB", "NaN"} {
+		if _, err := ParseByteSize(in); err == nil {
+			t.Errorf("ParseByteSize(%q): expected error", in)
+		}
+	}
+	for _, tt := range []struct {
+		in   ByteSize
+		want string
+	}{
+		{0, "0B"},
+		{1500, "1500B"},
+		{2000, "2KB"},
+		{512 << 20, "512MiB"},
+	} {
+		if got := tt.in.String(); got != tt.want {
+			t.Errorf("ByteSize(%d).String() = %q, want %q", int64(tt.in), got, tt.want)
+		}
+	}
+}
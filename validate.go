@@ -0,0 +1,96 @@
+package hclconfig
+
+import (
+	"reflect"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+)
+
+// Validator is implemented by configuration structs that check their own
+// invariants. Validate is called on every decoded block, nested block and
+// slice element, and on the destination struct itself, once it has been
+// decoded. A returned error is reported at the block's definition.
+type Validator interface {
+	Validate() error
+}
+
+// HCLValidator is like Validator but returns diagnostics, which may point at
+// particular attributes. ctx is the eval context the block was decoded with.
+// Diagnostics without a subject are reported at the block's definition.
+type HCLValidator interface {
+	ValidateHCL(ctx *hcl.EvalContext) hcl.Diagnostics
+}
+
+// validateBlock checks the validate tags and runs the validators of the
+// struct rv, decoded from block, after those of the nested blocks it
+// contains.
+func validateBlock(rv reflect.Value, block *hcl.Block, evalCtx *hcl.EvalContext) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+
+	var own hcl.Diagnostics
+	schema, _ := gohcl.ImpliedBodySchema(rv.Addr().Interface())
+	if content, _, _ := block.Body.PartialContent(schema); content != nil {
+		own = checkConstraints(rv, content.Attributes, block.DefRange)
+		blocksByType := content.Blocks.ByType()
+		rt := rv.Type()
+		for i := 0; i < rt.NumField(); i++ {
+			name, kind := parseHCLTag(rt.Field(i).Tag.Get("hcl"))
+			if kind != "block" {
+				continue
+			}
+			blocks := blocksByType[name]
+			elems := blockElems(rv.Field(i))
+			for j := 0; j < len(elems) && j < len(blocks); j++ {
+				diags = append(diags, validateBlock(elems[j], blocks[j], evalCtx)...)
+			}
+		}
+	}
+
+	// Hooks may rely on the constraints holding.
+	if !own.HasErrors() {
+		own = append(own, runValidators(rv, evalCtx, block.DefRange)...)
+	}
+	if len(own) > 0 {
+		diags = append(diags, errorDiags(wrapBlockDiags(block, own))...)
+	}
+	return diags
+}
+
+// runValidators calls Validate and ValidateHCL on rv, or on its address,
+// if implemented. Failures without a location are reported at rng, or without
+// one if rng is empty.
+func runValidators(rv reflect.Value, evalCtx *hcl.EvalContext, rng hcl.Range) hcl.Diagnostics {
+	v := rv.Interface()
+	if rv.CanAddr() {
+		v = rv.Addr().Interface()
+	}
+
+	var subject *hcl.Range
+	if rng != (hcl.Range{}) {
+		subject = rng.Ptr()
+	}
+
+	var diags hcl.Diagnostics
+	if validator, ok := v.(Validator); ok {
+		if err := validator.Validate(); err != nil {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid configuration",
+				Detail:   err.Error(),
+				Subject:  subject,
+			})
+		}
+	}
+	if validator, ok := v.(HCLValidator); ok {
+		for _, d := range validator.ValidateHCL(evalCtx) {
+			if d.Subject == nil && subject != nil {
+				cp := *d
+				cp.Subject = subject
+				d = &cp
+			}
+			diags = append(diags, d)
+		}
+	}
+	return diags
+}
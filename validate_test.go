@@ -0,0 +1,118 @@
+package hclconfig
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/hcl/v2"
+)
+
+type ValidatedPool struct {
+	Min int `hcl:"min,attr"`
+	Max int `hcl:"max,attr"`
+}
+
+func (p *ValidatedPool) Validate() error {
+	if p.Min > p.Max {
+		return fmt.Errorf("min (%d) must not exceed max (%d)", p.Min, p.Max)
+	}
+	return nil
+}
+
+type ValidatedDB struct {
+	Host string         `hcl:"host,attr"`
+	Port int            `hcl:"port,attr"`
+	Pool *ValidatedPool `hcl:"pool,block"`
+}
+
+func (d ValidatedDB) ValidateHCL(ctx *hcl.EvalContext) hcl.Diagnostics {
+	if d.Port <= 0 || d.Port > 65535 {
+		return hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid port",
+			Detail:   fmt.Sprintf("Port %d is out of range.", d.Port),
+		}}
+	}
+	return nil
+}
+
+type ValidatedConfig struct {
+	Databases []ValidatedDB `hcl:"database,block"`
+	App       AppConfig     `hcl:"app,block"`
+}
+
+var errNoDatabases = errors.New("at least one database is required")
+
+func (c *ValidatedConfig) Validate() error {
+	if len(c.Databases) == 0 {
+		return errNoDatabases
+	}
+	return nil
+}
+
+func TestLoad_Validate(t *testing.T) {
+	src := []byte(`
+database {
+    host = "a"
+    port = 5432
+    pool {
+        min = 10
+        max = 5
+    }
+}
+database {
+    host = "b"
+    port = 70000
+}
+app {
+    db_url = database[1].host
+}
+`)
+	var cfg ValidatedConfig
+	err := Load(src, "test.hcl", &cfg)
+	if err == nil {
+		t.Fatal("expected validation errors")
+	}
+	msg := err.Error()
+	for _, want := range []string{
+		"test.hcl:5,5: Invalid configuration: In pool block defined at test.hcl:5: min (10) must not exceed max (5)",
+		"test.hcl:10,1: Invalid port: In database block defined at test.hcl:10: Port 70000 is out of range.",
+	} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("expected %q in error, got:\n%s", want, msg)
+		}
+	}
+}
+
+func TestLoad_ValidateRoot(t *testing.T) {
+	src := []byte(`
+app {
+    db_url = "x"
+}
+`)
+	var cfg ValidatedConfig
+	err := Load(src, "test.hcl", &cfg)
+	want := "test.hcl:1,1: Invalid configuration: " + errNoDatabases.Error()
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("expected %q, got: %v", want, err)
+	}
+
+	src = []byte(`
+database {
+    host = "a"
+    port = 5432
+    pool {
+        min = 1
+        max = 5
+    }
+}
+app {
+    db_url = database[0].host
+}
+`)
+	if err := Load(src, "test.hcl", &cfg); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
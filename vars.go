@@ -0,0 +1,586 @@
+package hclconfig
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/ext/typeexpr"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+)
+
+// Variable describes a var block and the value it resolved to.
+type Variable struct {
+	Name        string
+	Description string
+	Type        cty.Type // cty.DynamicPseudoType when no type is declared
+	Sensitive   bool
+	Nullable    bool
+	Value       cty.Value
+	DeclRange   hcl.Range
+}
+
+// WithVariables records every var block's declaration and resolved value in
+// *vars, in declaration order, once loading succeeds.
+func WithVariables(vars *[]Variable) Option {
+	return func(o *options) {
+		o.variables = vars
+	}
+}
+
+// WithVars supplies var values from Go. Values may be Go primitives, slices,
+// maps, structs with hcl tags or cty.Value, and are converted to the var's
+// declared type. Naming a var that is not declared is an error.
+func WithVars(vars map[string]any) Option {
+	return func(o *options) {
+		o.vars = append(o.vars, vars)
+	}
+}
+
+// WithVarsFromEnv supplies var values from environment variables whose names
+// start with prefix: with prefix "APP_VAR_", APP_VAR_api_host sets
+// var.api_host. Values are parsed as described for WithVarFlags.
+func WithVarsFromEnv(prefix string) Option {
+	return func(o *options) {
+		o.varEnvPrefixes = append(o.varEnvPrefixes, prefix)
+	}
+}
+
+// WithVarsFile supplies var values from an .hclvars file containing one
+// "name = value" attribute per var. Values must be constants. Files ending in
+// ".json" are parsed as HCL JSON.
+func WithVarsFile(filename string) Option {
+	return func(o *options) {
+		o.varFiles = append(o.varFiles, filename)
+	}
+}
+
+// WithVarFlags supplies var values as "name=value" strings, as accepted by a
+// repeatable -var command-line flag. A value for a var of primitive or
+// unspecified type is taken as a literal string; for collection and object
+// types it is parsed as an HCL expression such as ["a", "b"].
+func WithVarFlags(flags []string) Option {
+	return func(o *options) {
+		o.varFlags = append(o.varFlags, flags...)
+	}
+}
+
+// varOverride is a var value supplied from outside the configuration.
+type varOverride struct {
+	source string     // describes where the value came from, for diagnostics
+	kind   SourceKind // SourceEnv or SourceOverride
+	value  cty.Value  // typed value; cty.NilVal when raw is used instead
+	raw    string     // string value to be parsed according to the declared type
+	rng    hcl.Range  // definition in a vars file; zero when not from a file
+}
+
+// varOverrides collects the values supplied for the declared vars. Later
+// sources take precedence over earlier ones: environment variables, then
+// vars files in the order given, then WithVars, then WithVarFlags. Any of
+// them takes precedence over a var's default.
+func (o options) varOverrides(decls map[string]*varDecl) (map[string]varOverride, error) {
+	overrides := make(map[string]varOverride)
+	var diags hcl.Diagnostics
+
+	undeclared := func(name, source string, subject *hcl.Range) {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Undeclared variable",
+			Detail:   fmt.Sprintf("A value for var %q was supplied by %s, but no var block declares it.", name, source),
+			Subject:  subject,
+		})
+	}
+
+	for _, prefix := range o.varEnvPrefixes {
+		for _, kv := range os.Environ() {
+			name, value, ok := strings.Cut(kv, "=")
+			if !ok || !strings.HasPrefix(name, prefix) {
+				continue
+			}
+			// Unrelated variables may share the prefix, so unknown names are
+			// ignored.
+			varName := strings.TrimPrefix(name, prefix)
+			if _, declared := decls[varName]; declared {
+				overrides[varName] = varOverride{source: "environment variable " + name, kind: SourceEnv, raw: value}
+			}
+		}
+	}
+
+	parser := hclparse.NewParser()
+	for _, filename := range o.varFiles {
+		if o.onRead != nil {
+			o.onRead(filename)
+		}
+		src, err := os.ReadFile(filename)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", filename, err)
+		}
+		file, fileDiags := parseSource(parser, src, filename, SyntaxAuto)
+		if fileDiags.HasErrors() {
+			diags = append(diags, fileDiags...)
+			continue
+		}
+		attrs, attrDiags := file.Body.JustAttributes()
+		diags = append(diags, attrDiags...)
+		for _, attr := range sortedAttributes(attrs) {
+			if _, declared := decls[attr.Name]; !declared {
+				undeclared(attr.Name, filename, attr.NameRange.Ptr())
+				continue
+			}
+			val, valDiags := attr.Expr.Value(nil)
+			diags = append(diags, valDiags...)
+			if valDiags.HasErrors() {
+				continue
+			}
+			overrides[attr.Name] = varOverride{source: filename, kind: SourceOverride, value: val, rng: attr.Expr.Range()}
+		}
+	}
+
+	for _, vars := range o.vars {
+		for name, v := range vars {
+			if _, declared := decls[name]; !declared {
+				undeclared(name, "WithVars", nil)
+				continue
+			}
+			val, err := goToCtyValue(v, o.encoders)
+			if err != nil {
+				return nil, fmt.Errorf("var %q: %w", name, err)
+			}
+			overrides[name] = varOverride{source: "WithVars", kind: SourceOverride, value: val}
+		}
+	}
+
+	for _, flag := range o.varFlags {
+		name, value, ok := strings.Cut(flag, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid var flag %q: expected name=value", flag)
+		}
+		if _, declared := decls[name]; !declared {
+			undeclared(name, "a var flag", nil)
+			continue
+		}
+		overrides[name] = varOverride{source: "var flag", kind: SourceOverride, raw: value}
+	}
+
+	if diags.HasErrors() {
+		return nil, &DiagnosticsError{Diags: diags}
+	}
+	return overrides, nil
+}
+
+// goToCtyValue converts a Go value supplied through WithVars.
+func goToCtyValue(v any, encoders typeEncoders) (cty.Value, error) {
+	if v == nil {
+		return cty.NullVal(cty.DynamicPseudoType), nil
+	}
+	val, err := reflectToCtyValue(reflect.ValueOf(v), encoders)
+	if err != nil {
+		return cty.NilVal, err
+	}
+	if val == cty.NilVal {
+		return cty.NullVal(cty.DynamicPseudoType), nil
+	}
+	return val, nil
+}
+
+var varBlockSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{
+		{Name: "default"},
+		{Name: "type"},
+		{Name: "description"},
+		{Name: "sensitive"},
+		{Name: "nullable"},
+	},
+	Blocks: []hcl.BlockHeaderSchema{
+		{Type: "validation"},
+	},
+}
+
+var varValidationSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{
+		{Name: "condition", Required: true},
+		{Name: "error_message", Required: true},
+	},
+}
+
+// varValidation is a validation block within a var block.
+type varValidation struct {
+	condition    hcl.Expression
+	errorMessage hcl.Expression
+	defRange     hcl.Range
+}
+
+// varDecl is a parsed var block.
+type varDecl struct {
+	Variable
+	block       *hcl.Block
+	defaultAttr *hcl.Attribute
+	defaults    *typeexpr.Defaults
+	validations []varValidation
+}
+
+// decodeVarBlock parses the declaration attributes of a var block. Everything
+// except default must be a constant.
+func decodeVarBlock(block *hcl.Block) (*varDecl, hcl.Diagnostics) {
+	decl := &varDecl{
+		Variable: Variable{
+			Name:      block.Labels[0],
+			Type:      cty.DynamicPseudoType,
+			Nullable:  true,
+			DeclRange: block.DefRange,
+		},
+		block: block,
+	}
+
+	content, diags := block.Body.Content(varBlockSchema)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	decl.defaultAttr = content.Attributes["default"]
+
+	if attr, ok := content.Attributes["type"]; ok {
+		ty, defaults, typeDiags := typeexpr.TypeConstraintWithDefaults(attr.Expr)
+		diags = append(diags, typeDiags...)
+		decl.Type = ty
+		decl.defaults = defaults
+	}
+	if attr, ok := content.Attributes["description"]; ok {
+		diags = append(diags, decodeConstAttr(attr, cty.String, func(v cty.Value) { decl.Description = v.AsString() })...)
+	}
+	if attr, ok := content.Attributes["sensitive"]; ok {
+		diags = append(diags, decodeConstAttr(attr, cty.Bool, func(v cty.Value) { decl.Sensitive = v.True() })...)
+	}
+	if attr, ok := content.Attributes["nullable"]; ok {
+		diags = append(diags, decodeConstAttr(attr, cty.Bool, func(v cty.Value) { decl.Nullable = v.True() })...)
+	}
+	for _, block := range content.Blocks {
+		vc, vDiags := block.Body.Content(varValidationSchema)
+		diags = append(diags, vDiags...)
+		if vDiags.HasErrors() {
+			continue
+		}
+		decl.validations = append(decl.validations, varValidation{
+			condition:    vc.Attributes["condition"].Expr,
+			errorMessage: vc.Attributes["error_message"].Expr,
+			defRange:     block.DefRange,
+		})
+	}
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	return decl, diags
+}
+
+// decodeConstAttr evaluates attr without variables or functions, converts it
+// to ty and passes the result to set.
+func decodeConstAttr(attr *hcl.Attribute, ty cty.Type, set func(cty.Value)) hcl.Diagnostics {
+	val, diags := attr.Expr.Value(nil)
+	if diags.HasErrors() {
+		return diags
+	}
+	val, err := convert.Convert(val, ty)
+	if err != nil || val.IsNull() {
+		return hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  fmt.Sprintf("Invalid %s argument", attr.Name),
+			Detail:   fmt.Sprintf("The %s argument must be a %s constant.", attr.Name, ty.FriendlyName()),
+			Subject:  attr.Expr.Range().Ptr(),
+		}}
+	}
+	set(val)
+	return nil
+}
+
+// value resolves the var from its override, if any, or else from its
+// default, and converts it to the declared type.
+func (d *varDecl) value(evalCtx *hcl.EvalContext, override *varOverride) (cty.Value, error) {
+	if override != nil {
+		return d.overrideValue(override)
+	}
+	if d.defaultAttr == nil {
+		return cty.NilVal, &DiagnosticsError{Diags: hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  "No value for required variable",
+			Detail: fmt.Sprintf("var %q has no default, so a value must be supplied with WithVars, "+
+				"WithVarsFromEnv, WithVarsFile or WithVarFlags.", d.Name),
+			Subject: d.DeclRange.Ptr(),
+		}}}
+	}
+	val, diags := d.defaultAttr.Expr.Value(evalCtx)
+	if diags.HasErrors() {
+		return cty.NilVal, &DiagnosticsError{Diags: diags}
+	}
+	return d.convert(val, d.defaultAttr.Expr.Range())
+}
+
+// overrideValue converts a value supplied from outside the configuration.
+// Diagnostics point at the vars file attribute when there is one and at the
+// var block otherwise.
+func (d *varDecl) overrideValue(override *varOverride) (cty.Value, error) {
+	rng := override.rng
+	if rng.Filename == "" {
+		rng = d.DeclRange
+	}
+
+	val := override.value
+	if val == cty.NilVal {
+		if d.Type == cty.DynamicPseudoType || d.Type.IsPrimitiveType() {
+			val = cty.StringVal(override.raw)
+		} else {
+			filename := fmt.Sprintf("<value for var.%s>", d.Name)
+			expr, diags := hclsyntax.ParseExpression([]byte(override.raw), filename, hcl.InitialPos)
+			if !diags.HasErrors() {
+				val, diags = expr.Value(nil)
+			}
+			if diags.HasErrors() {
+				return cty.NilVal, &DiagnosticsError{Diags: diags}
+			}
+		}
+	}
+
+	val, err := d.convert(val, rng)
+	var diagErr *DiagnosticsError
+	if errors.As(err, &diagErr) {
+		for _, diag := range diagErr.Diags {
+			diag.Detail += fmt.Sprintf(" The value was supplied by %s.", override.source)
+		}
+	}
+	return val, err
+}
+
+// validate evaluates the var's validation blocks. evalCtx must already hold
+// the var's resolved value. Every failing rule is reported, with the
+// diagnostic pointing at its condition.
+func (d *varDecl) validate(evalCtx *hcl.EvalContext) error {
+	var diags hcl.Diagnostics
+	for _, v := range d.validations {
+		result, condDiags := v.condition.Value(evalCtx)
+		if condDiags.HasErrors() {
+			diags = append(diags, condDiags...)
+			continue
+		}
+		result, err := convert.Convert(result, cty.Bool)
+		if err != nil || result.IsNull() || !result.IsKnown() {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid validation result",
+				Detail:   fmt.Sprintf("The condition for var %q must return either true or false.", d.Name),
+				Subject:  v.condition.Range().Ptr(),
+			})
+			continue
+		}
+		if result.True() {
+			continue
+		}
+
+		msg, msgDiags := v.errorMessage.Value(evalCtx)
+		if !msgDiags.HasErrors() {
+			msg, err = convert.Convert(msg, cty.String)
+		}
+		if msgDiags.HasErrors() || err != nil || msg.IsNull() || !msg.IsKnown() {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid validation error message",
+				Detail:   fmt.Sprintf("The error_message for var %q must evaluate to a string.", d.Name),
+				Subject:  v.errorMessage.Range().Ptr(),
+			})
+			continue
+		}
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid value for variable",
+			Detail: fmt.Sprintf("%s\n\nThis was checked by the validation rule at %s.",
+				msg.AsString(), v.defRange.String()),
+			Subject:    v.condition.Range().Ptr(),
+			Expression: v.errorMessage,
+		})
+	}
+	if diags.HasErrors() {
+		return &DiagnosticsError{Diags: diags}
+	}
+	return nil
+}
+
+// convert applies the declared type constraint, optional attribute defaults
+// and nullability to val, reporting failures at rng.
+func (d *varDecl) convert(val cty.Value, rng hcl.Range) (cty.Value, error) {
+	if d.defaults != nil {
+		val = d.defaults.Apply(val)
+	}
+	if val.IsNull() {
+		if !d.Nullable {
+			return cty.NilVal, &DiagnosticsError{Diags: hcl.Diagnostics{{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid value for variable",
+				Detail:   fmt.Sprintf("The value of var %q must not be null because it is declared with nullable = false.", d.Name),
+				Subject:  rng.Ptr(),
+			}}}
+		}
+		return cty.NullVal(d.Type), nil
+	}
+
+	conv, err := convert.Convert(val, d.Type)
+	if err != nil {
+		return cty.NilVal, &DiagnosticsError{Diags: hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid value for variable",
+			Detail: fmt.Sprintf("The value of var %q is not compatible with its type constraint %s: %s.",
+				d.Name, typeexpr.TypeString(d.Type), convertErrorMessage(err)),
+			Subject: rng.Ptr(),
+		}}}
+	}
+	return conv, nil
+}
+
+// convertErrorMessage prefixes a conversion error with the path it occurred at.
+func convertErrorMessage(err error) string {
+	var pathErr cty.PathError
+	if !errors.As(err, &pathErr) || len(pathErr.Path) == 0 {
+		return err.Error()
+	}
+	var path strings.Builder
+	for _, step := range pathErr.Path {
+		switch s := step.(type) {
+		case cty.GetAttrStep:
+			fmt.Fprintf(&path, ".%s", s.Name)
+		case cty.IndexStep:
+			if s.Key.Type() == cty.String {
+				fmt.Fprintf(&path, "[%q]", s.Key.AsString())
+			} else if s.Key.Type() == cty.Number {
+				fmt.Fprintf(&path, "[%s]", s.Key.AsBigFloat().Text('f', -1))
+			}
+		}
+	}
+	return fmt.Sprintf("%s: %s", strings.TrimPrefix(path.String(), "."), err.Error())
+}
+
+// redactSensitive replaces the values of sensitive vars, keyed by name, with
+// a placeholder in err's message. A diagnostic whose expression is known is
+// only redacted for the sensitive vars that expression refers to; other
+// diagnostics and plain errors are redacted for all of them.
+func redactSensitive(err error, sensitive map[string]cty.Value) error {
+	if err == nil || len(sensitive) == 0 {
+		return err
+	}
+	redact := func(s string, names map[string]bool) string {
+		for name, val := range sensitive {
+			if names != nil && !names[name] {
+				continue
+			}
+			for _, secret := range sensitiveLeaves(val) {
+				s = secret.redact(s)
+			}
+		}
+		return s
+	}
+
+	var diagErr *DiagnosticsError
+	if errors.As(err, &diagErr) {
+		redacted := make(hcl.Diagnostics, len(diagErr.Diags))
+		for i, d := range diagErr.Diags {
+			var names map[string]bool
+			if d.Expression != nil {
+				names = referencedVars(d.Expression)
+			}
+			cp := *d
+			cp.Summary = redact(d.Summary, names)
+			cp.Detail = redact(d.Detail, names)
+			redacted[i] = &cp
+		}
+		return &DiagnosticsError{Diags: redacted}
+	}
+	if msg := err.Error(); redact(msg, nil) != msg {
+		return errors.New(redact(msg, nil))
+	}
+	return err
+}
+
+// referencedVars returns the names of the vars expr refers to as var.<name>.
+func referencedVars(expr hcl.Expression) map[string]bool {
+	names := make(map[string]bool)
+	for _, traversal := range expr.Variables() {
+		if traversal.RootName() != "var" || len(traversal) < 2 {
+			continue
+		}
+		if attr, ok := traversal[1].(hcl.TraverseAttr); ok {
+			names[attr.Name] = true
+		}
+	}
+	return names
+}
+
+// sensitiveLeaf is a value within a sensitive var, as a message would show it.
+type sensitiveLeaf struct {
+	text string
+	word bool // numbers and bools are redacted only where they stand alone
+}
+
+// redact replaces the leaf in s with a placeholder.
+func (l sensitiveLeaf) redact(s string) string {
+	const placeholder = "(sensitive value)"
+	if !l.word {
+		return strings.ReplaceAll(s, l.text, placeholder)
+	}
+	var b strings.Builder
+	for {
+		i := strings.Index(s, l.text)
+		if i < 0 {
+			b.WriteString(s)
+			return b.String()
+		}
+		end := i + len(l.text)
+		before := i > 0 && (isWordByte(s[i-1]) || s[i-1] == '.' && i > 1 && isDigit(s[i-2]))
+		after := end < len(s) && (isWordByte(s[end]) || s[end] == '.' && end+1 < len(s) && isDigit(s[end+1]))
+		if before || after {
+			b.WriteString(s[:end])
+		} else {
+			b.WriteString(s[:i])
+			b.WriteString(placeholder)
+		}
+		s = s[end:]
+	}
+}
+
+// isWordByte reports whether c may be part of a word or number.
+func isWordByte(c byte) bool {
+	return c == '_' || isDigit(c) || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// sensitiveLeaves collects the non-empty strings, numbers and bools within val.
+func sensitiveLeaves(val cty.Value) []sensitiveLeaf {
+	if val.IsNull() || !val.IsKnown() {
+		return nil
+	}
+	ty := val.Type()
+	switch {
+	case ty == cty.String:
+		if s := val.AsString(); s != "" {
+			return []sensitiveLeaf{{text: s}}
+		}
+	case ty == cty.Number || ty == cty.Bool:
+		// Formatted as string interpolation would show it.
+		s, err := convert.Convert(val, cty.String)
+		if err == nil {
+			return []sensitiveLeaf{{text: s.AsString(), word: true}}
+		}
+	case ty.IsListType() || ty.IsSetType() || ty.IsTupleType() || ty.IsMapType() || ty.IsObjectType():
+		var out []sensitiveLeaf
+		for it := val.ElementIterator(); it.Next(); {
+			_, v := it.Element()
+			out = append(out, sensitiveLeaves(v)...)
+		}
+		return out
+	}
+	return nil
+}
@@ -0,0 +1,534 @@
+package hclconfig
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+	"github.com/zclconf/go-cty/cty/function/stdlib"
+)
+
+type VarListConfig struct {
+	Service struct {
+		Hosts []string `hcl:"hosts,attr"`
+	} `hcl:"service,block"`
+}
+
+func TestLoad_Var_TypeConversion(t *testing.T) {
+	src := []byte(`
+var "port" {
+  type    = number
+  default = "8080"
+}
+
+service {
+  url = "http://localhost:${var.port + 1}"
+}
+`)
+	var cfg VarTestConfig
+	err := Load(src, "test.hcl", &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "http://localhost:8081"
+	if cfg.Service.URL != expected {
+		t.Errorf("service.url = %q, want %q", cfg.Service.URL, expected)
+	}
+}
+
+func TestLoad_Var_ListType(t *testing.T) {
+	src := []byte(`
+var "hosts" {
+  type    = list(string)
+  default = ["a", "b"]
+}
+
+service {
+  hosts = var.hosts
+}
+`)
+	var cfg VarListConfig
+	err := Load(src, "test.hcl", &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(cfg.Service.Hosts, ",") != "a,b" {
+		t.Errorf("hosts = %v, want [a b]", cfg.Service.Hosts)
+	}
+}
+
+func TestLoad_Var_ObjectTypeOptionalDefaults(t *testing.T) {
+	src := []byte(`
+var "db" {
+  type = object({
+    host = string
+    port = optional(number, 5432)
+  })
+  default = {
+    host = "localhost"
+  }
+}
+
+service {
+  url = "postgres://${var.db.host}:${var.db.port}"
+}
+`)
+	var cfg VarTestConfig
+	err := Load(src, "test.hcl", &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "postgres://localhost:5432"
+	if cfg.Service.URL != expected {
+		t.Errorf("service.url = %q, want %q", cfg.Service.URL, expected)
+	}
+}
+
+func TestLoad_Var_TypeMismatch(t *testing.T) {
+	src := []byte(`
+var "db" {
+  type = object({
+    host = string
+    port = number
+  })
+  default = {
+    host = "localhost"
+    port = "not-a-number"
+  }
+}
+`)
+	var cfg struct{}
+	err := Load(src, "mismatch.hcl", &cfg)
+	if err == nil {
+		t.Fatal("expected type mismatch error")
+	}
+	diagErr, ok := err.(*DiagnosticsError)
+	if !ok {
+		t.Fatalf("expected DiagnosticsError, got %T: %v", err, err)
+	}
+	msg := diagErr.Error()
+	if !strings.Contains(msg, "mismatch.hcl:7,") {
+		t.Errorf("error should point at the default, got: %s", msg)
+	}
+	if !strings.Contains(msg, `var "db"`) || !strings.Contains(msg, "port") {
+		t.Errorf("error should name the var and the offending attribute, got: %s", msg)
+	}
+}
+
+func TestLoad_Var_NotNullable(t *testing.T) {
+	src := []byte(`
+var "host" {
+  nullable = false
+  default  = null
+}
+`)
+	var cfg struct{}
+	err := Load(src, "test.hcl", &cfg)
+	if err == nil {
+		t.Fatal("expected error for null non-nullable var")
+	}
+	if !strings.Contains(err.Error(), "must not be null") {
+		t.Errorf("expected null error, got: %v", err)
+	}
+}
+
+func TestLoad_Var_UnknownAttribute(t *testing.T) {
+	src := []byte(`
+var "host" {
+  default = "localhost"
+  defualt = "typo"
+}
+`)
+	var cfg struct{}
+	err := Load(src, "test.hcl", &cfg)
+	if err == nil {
+		t.Fatal("expected error for unknown var attribute")
+	}
+	if !strings.Contains(err.Error(), "defualt") {
+		t.Errorf("expected error naming the unknown attribute, got: %v", err)
+	}
+}
+
+func TestLoad_Var_SensitiveRedacted(t *testing.T) {
+	src := []byte(`
+var "password" {
+  sensitive = true
+  default   = "hunter2"
+}
+
+service {
+  url = check(var.password)
+}
+`)
+	ctx := &hcl.EvalContext{
+		Functions: map[string]function.Function{
+			"check": function.New(&function.Spec{
+				Params: []function.Parameter{{Name: "s", Type: cty.String}},
+				Type:   function.StaticReturnType(cty.String),
+				Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+					return cty.NilVal, fmt.Errorf("rejected %q", args[0].AsString())
+				},
+			}),
+		},
+	}
+	var cfg VarTestConfig
+	err := Load(src, "test.hcl", &cfg, WithEvalContext(ctx))
+	if err == nil {
+		t.Fatal("expected error from check()")
+	}
+	if strings.Contains(err.Error(), "hunter2") {
+		t.Errorf("error should not contain the sensitive value, got: %v", err)
+	}
+	if !strings.Contains(err.Error(), "(sensitive value)") {
+		t.Errorf("error should contain a redaction placeholder, got: %v", err)
+	}
+}
+
+func TestLoad_Var_SensitiveNumberRedacted(t *testing.T) {
+	src := []byte(`
+var "pin" {
+  type      = number
+  sensitive = true
+  default   = 987654
+  validation {
+    condition     = var.pin < 10000
+    error_message = "pin ${var.pin} too big, must be below 10000."
+  }
+}
+`)
+	var cfg struct{}
+	err := Load(src, "test.hcl", &cfg)
+	if err == nil {
+		t.Fatal("expected validation error")
+	}
+	if strings.Contains(err.Error(), "987654") {
+		t.Errorf("error should not contain the sensitive value, got: %v", err)
+	}
+	if !strings.Contains(err.Error(), "pin (sensitive value) too big") {
+		t.Errorf("error should contain a redaction placeholder, got: %v", err)
+	}
+}
+
+func TestLoad_Var_SensitiveRedactsOnlyReferencingDiagnostics(t *testing.T) {
+	// The secret "a" is not redacted from diagnostics about other values.
+	src := []byte(`
+var "short" {
+  sensitive = true
+  default   = "a"
+}
+
+service {
+  url = undefined_name
+}
+`)
+	var cfg VarTestConfig
+	err := Load(src, "test.hcl", &cfg)
+	if err == nil || !strings.Contains(err.Error(), `There is no variable named "undefined_name"`) {
+		t.Errorf("expected unredacted error, got: %v", err)
+	}
+}
+
+func TestLoad_WithVariables(t *testing.T) {
+	src := []byte(`
+var "api_host" {
+  description = "Host name of the API"
+  type        = string
+  default     = "api.example.com"
+}
+
+var "api_port" {
+  type      = number
+  sensitive = true
+  default   = 8080
+}
+`)
+	var vars []Variable
+	var cfg struct{}
+	err := Load(src, "test.hcl", &cfg, WithVariables(&vars))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vars) != 2 {
+		t.Fatalf("expected 2 variables, got %d", len(vars))
+	}
+	if vars[0].Name != "api_host" || vars[0].Description != "Host name of the API" {
+		t.Errorf("unexpected first variable: %+v", vars[0])
+	}
+	if !vars[0].Nullable || vars[0].Sensitive {
+		t.Errorf("api_host should be nullable and not sensitive: %+v", vars[0])
+	}
+	if !vars[1].Sensitive || vars[1].Type != cty.Number {
+		t.Errorf("api_port should be a sensitive number: %+v", vars[1])
+	}
+	if !vars[1].Value.RawEquals(cty.NumberIntVal(8080)) {
+		t.Errorf("api_port value = %#v, want 8080", vars[1].Value)
+	}
+}
+
+func TestLoad_WithVars(t *testing.T) {
+	src := []byte(`
+var "host" {
+}
+
+var "port" {
+  type    = number
+  default = 80
+}
+
+service {
+  url = "http://${var.host}:${var.port}"
+}
+`)
+	var cfg VarTestConfig
+	err := Load(src, "test.hcl", &cfg, WithVars(map[string]any{
+		"host": "example.com",
+		"port": 8080,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "http://example.com:8080"
+	if cfg.Service.URL != expected {
+		t.Errorf("service.url = %q, want %q", cfg.Service.URL, expected)
+	}
+}
+
+func TestLoad_WithVars_Undeclared(t *testing.T) {
+	var cfg struct{}
+	err := Load([]byte(`var "host" { default = "x" }`), "test.hcl", &cfg,
+		WithVars(map[string]any{"hots": "y"}))
+	if err == nil {
+		t.Fatal("expected error for undeclared var")
+	}
+	if !strings.Contains(err.Error(), "Undeclared variable") {
+		t.Errorf("expected undeclared variable error, got: %v", err)
+	}
+}
+
+func TestLoad_WithVarsFromEnv(t *testing.T) {
+	t.Setenv("TEST_APP_VAR_api_host", "env.example.com")
+	t.Setenv("TEST_APP_VAR_hosts", `["a", "b"]`)
+
+	src := []byte(`
+var "api_host" {
+  default = "api.example.com"
+}
+
+var "hosts" {
+  type    = list(string)
+  default = []
+}
+
+service {
+  url = "http://${var.api_host}/${join(",", var.hosts)}"
+}
+`)
+	ctx := &hcl.EvalContext{
+		Functions: map[string]function.Function{
+			"join": stdlib.JoinFunc,
+		},
+	}
+	var cfg VarTestConfig
+	err := Load(src, "test.hcl", &cfg, WithVarsFromEnv("TEST_APP_VAR_"), WithEvalContext(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "http://env.example.com/a,b"
+	if cfg.Service.URL != expected {
+		t.Errorf("service.url = %q, want %q", cfg.Service.URL, expected)
+	}
+}
+
+func TestLoad_WithVarsFile(t *testing.T) {
+	src := []byte(`
+var "api_host" {
+}
+
+var "api_port" {
+  type = number
+}
+
+service {
+  url = "http://${var.api_host}:${var.api_port}/api"
+}
+`)
+	var cfg VarTestConfig
+	err := Load(src, "test.hcl", &cfg, WithVarsFile("testdata/service.hclvars"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "http://vars.example.com:9090/api"
+	if cfg.Service.URL != expected {
+		t.Errorf("service.url = %q, want %q", cfg.Service.URL, expected)
+	}
+}
+
+func TestLoad_VarPrecedence(t *testing.T) {
+	t.Setenv("TEST_PREC_api_host", "env")
+
+	src := []byte(`
+var "api_host" {
+  default = "default"
+}
+
+var "api_port" {
+  default = 1
+}
+
+service {
+  url = "${var.api_host}:${var.api_port}"
+}
+`)
+	tests := []struct {
+		name     string
+		opts     []Option
+		expected string
+	}{
+		{"default", nil, "default:1"},
+		{"env over default", []Option{WithVarsFromEnv("TEST_PREC_")}, "env:1"},
+		{"file over env", []Option{WithVarsFromEnv("TEST_PREC_"), WithVarsFile("testdata/service.hclvars")}, "vars.example.com:9090"},
+		{"WithVars over file", []Option{
+			WithVarsFile("testdata/service.hclvars"),
+			WithVars(map[string]any{"api_host": "go"}),
+		}, "go:9090"},
+		{"flags over WithVars", []Option{
+			WithVarFlags([]string{"api_host=flag"}),
+			WithVars(map[string]any{"api_host": "go"}),
+		}, "flag:1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cfg VarTestConfig
+			if err := Load(src, "test.hcl", &cfg, tt.opts...); err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Service.URL != tt.expected {
+				t.Errorf("service.url = %q, want %q", cfg.Service.URL, tt.expected)
+			}
+		})
+	}
+}
+
+func TestLoad_WithVarFlags_TypeMismatch(t *testing.T) {
+	src := []byte(`
+var "port" {
+  type = number
+}
+`)
+	var cfg struct{}
+	err := Load(src, "test.hcl", &cfg, WithVarFlags([]string{"port=http"}))
+	if err == nil {
+		t.Fatal("expected type mismatch error")
+	}
+	if !strings.Contains(err.Error(), "var flag") {
+		t.Errorf("error should name the source of the value, got: %v", err)
+	}
+}
+
+func TestLoad_Var_Validation(t *testing.T) {
+	src := []byte(`
+var "port" {
+  type    = number
+  default = 70000
+
+  validation {
+    condition     = var.port > 0 && var.port < 65536
+    error_message = "Port must be between 1 and 65535, got ${var.port}."
+  }
+}
+`)
+	var cfg struct{}
+	err := Load(src, "validate.hcl", &cfg)
+	if err == nil {
+		t.Fatal("expected validation error")
+	}
+	diagErr, ok := err.(*DiagnosticsError)
+	if !ok {
+		t.Fatalf("expected DiagnosticsError, got %T: %v", err, err)
+	}
+	msg := diagErr.Error()
+	if !strings.Contains(msg, "Port must be between 1 and 65535, got 70000.") {
+		t.Errorf("error should contain the error message, got: %s", msg)
+	}
+	if !strings.Contains(msg, "validate.hcl:7,") {
+		t.Errorf("error should point at the condition, got: %s", msg)
+	}
+}
+
+func TestLoad_Var_ValidationPasses(t *testing.T) {
+	src := []byte(`
+var "host" {
+  default = "api.example.com"
+
+  validation {
+    condition     = var.host != ""
+    error_message = "Host must not be empty."
+  }
+}
+
+service {
+  url = "http://${var.host}"
+}
+`)
+	var cfg VarTestConfig
+	err := Load(src, "test.hcl", &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Service.URL != "http://api.example.com" {
+		t.Errorf("service.url = %q, want %q", cfg.Service.URL, "http://api.example.com")
+	}
+}
+
+func TestLoad_Var_ValidationAppliesToOverrides(t *testing.T) {
+	src := []byte(`
+var "host" {
+  default = "api.example.com"
+
+  validation {
+    condition     = var.host != ""
+    error_message = "Host must not be empty."
+  }
+
+  validation {
+    condition     = var.host != "localhost"
+    error_message = "Host must not be localhost."
+  }
+}
+`)
+	var cfg struct{}
+	err := Load(src, "test.hcl", &cfg, WithVars(map[string]any{"host": ""}))
+	if err == nil {
+		t.Fatal("expected validation error")
+	}
+	if !strings.Contains(err.Error(), "Host must not be empty.") {
+		t.Errorf("expected empty host error, got: %v", err)
+	}
+	if strings.Contains(err.Error(), "localhost") {
+		t.Errorf("only the failing rule should be reported, got: %v", err)
+	}
+}
+
+func TestLoad_Var_ValidationNonBool(t *testing.T) {
+	src := []byte(`
+var "host" {
+  default = "x"
+
+  validation {
+    condition     = "yes please"
+    error_message = "unused"
+  }
+}
+`)
+	var cfg struct{}
+	err := Load(src, "test.hcl", &cfg)
+	if err == nil {
+		t.Fatal("expected invalid validation result error")
+	}
+	if !strings.Contains(err.Error(), "Invalid validation result") {
+		t.Errorf("expected invalid validation result error, got: %v", err)
+	}
+}
@@ -0,0 +1,259 @@
+package hclconfig
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Default timings used by NewWatcher.
+const (
+	DefaultWatchInterval = time.Second
+	DefaultWatchDebounce = 250 * time.Millisecond
+)
+
+// ChangeFunc is called by a Watcher after every reload. On success old is the
+// value that was replaced, new is the value now returned by Current and err is
+// nil. On failure new is nil, err is the load error and old is still current.
+//
+// It runs on the watcher's polling goroutine, so it must not call Close, which
+// waits for that goroutine to exit.
+type ChangeFunc[T any] func(old, new *T, err error)
+
+// WatchOption configures a Watcher.
+type WatchOption func(*watchOptions)
+
+type watchOptions struct {
+	interval time.Duration
+	debounce time.Duration
+	loadOpts []Option
+}
+
+// WatchInterval sets how often the watched files are polled for changes. It
+// must be positive.
+func WatchInterval(d time.Duration) WatchOption {
+	return func(o *watchOptions) {
+		o.interval = d
+	}
+}
+
+// WatchDebounce sets how long the watched files must stay unchanged before a
+// reload, so that a burst of writes causes a single reload. It must be
+// positive.
+func WatchDebounce(d time.Duration) WatchOption {
+	return func(o *watchOptions) {
+		o.debounce = d
+	}
+}
+
+// WatchLoadOptions sets the options passed to LoadFile on every load.
+func WatchLoadOptions(opts ...Option) WatchOption {
+	return func(o *watchOptions) {
+		o.loadOpts = append(o.loadOpts, opts...)
+	}
+}
+
+// Watcher keeps a configuration loaded from a file up to date. It polls the
+// file and every file the configuration pulled in, such as through file(),
+// templatefile() or WithVarsFile, and reloads into a fresh value when any of
+// them changes. A new value only replaces the current one if it loads
+// without error.
+type Watcher[T any] struct {
+	filename string
+	onChange ChangeFunc[T]
+	opts     watchOptions
+
+	current atomic.Pointer[T]
+	files   []string // files polled for changes; owned by run
+	stop    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+}
+
+// NewWatcher loads filename into a new T and starts watching it. The initial
+// load must succeed; its error is returned otherwise. onChange may be nil.
+// Call Close to stop watching, but not from onChange.
+func NewWatcher[T any](filename string, onChange ChangeFunc[T], opts ...WatchOption) (*Watcher[T], error) {
+	w := &Watcher[T]{
+		filename: filename,
+		onChange: onChange,
+		opts: watchOptions{
+			interval: DefaultWatchInterval,
+			debounce: DefaultWatchDebounce,
+		},
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(&w.opts)
+	}
+	if w.opts.interval <= 0 {
+		return nil, fmt.Errorf("watch interval must be positive, got %s", w.opts.interval)
+	}
+	if w.opts.debounce <= 0 {
+		return nil, fmt.Errorf("watch debounce must be positive, got %s", w.opts.debounce)
+	}
+
+	val, files, snap, err := w.load()
+	if err != nil {
+		return nil, err
+	}
+	w.current.Store(val)
+	w.files = files
+
+	go w.run(snap)
+	return w, nil
+}
+
+// Current returns the most recently loaded configuration. It is safe to call
+// from multiple goroutines; callers must not modify the returned value.
+func (w *Watcher[T]) Current() *T {
+	return w.current.Load()
+}
+
+// Close stops watching and waits for any reload in progress to finish. It must
+// not be called from the ChangeFunc, which runs as part of a reload.
+func (w *Watcher[T]) Close() error {
+	w.once.Do(func() {
+		close(w.stop)
+	})
+	<-w.done
+	return nil
+}
+
+// load loads the watched file into a fresh value and returns it along with
+// every file the load read and the state of each file from just before it
+// was read, so that a write landing during the load still counts as a
+// change.
+func (w *Watcher[T]) load() (*T, []string, fileSnapshot, error) {
+	snap := fileSnapshot{w.filename: statFile(w.filename)}
+	files := []string{w.filename}
+	track := func(o *options) {
+		o.onRead = func(path string) {
+			if _, seen := snap[path]; !seen {
+				snap[path] = statFile(path)
+				files = append(files, path)
+			}
+		}
+	}
+
+	val := new(T)
+	opts := append(append([]Option{}, w.opts.loadOpts...), track)
+	if err := LoadFile(w.filename, val, opts...); err != nil {
+		return nil, files, snap, err
+	}
+	return val, files, snap, nil
+}
+
+// reload loads the file again and swaps the result in if it loaded. It
+// returns the state of the watched files to look for changes against: as of
+// before the load read them, or as in last for files it did not read.
+func (w *Watcher[T]) reload(last fileSnapshot) fileSnapshot {
+	old := w.Current()
+	val, files, snap, err := w.load()
+	if err != nil {
+		// Keep watching the files of the last good load too, so that fixing
+		// any of them triggers another attempt.
+		w.files = mergeFiles(w.files, files)
+		for _, path := range w.files {
+			if _, ok := snap[path]; !ok {
+				snap[path] = last[path]
+			}
+		}
+	} else {
+		w.current.Store(val)
+		w.files = files
+	}
+	if w.onChange != nil {
+		w.onChange(old, val, err)
+	}
+	return snap
+}
+
+// run polls the watched files until Close is called. last is their state
+// as of the initial load.
+func (w *Watcher[T]) run(last fileSnapshot) {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.opts.interval)
+	defer ticker.Stop()
+
+	var pending bool
+	var changedAt time.Time
+	for {
+		select {
+		case <-w.stop:
+			return
+		case now := <-ticker.C:
+			if snap := statFiles(w.files); !snap.equal(last) {
+				last = snap
+				pending = true
+				changedAt = now
+			}
+			if pending && now.Sub(changedAt) >= w.opts.debounce {
+				pending = false
+				last = w.reload(last)
+			}
+		}
+	}
+}
+
+// fileStat is the part of a file's state that signals a change.
+type fileStat struct {
+	exists  bool
+	size    int64
+	modTime time.Time
+}
+
+type fileSnapshot map[string]fileStat
+
+// statFiles records the current state of files. Missing files are recorded
+// too, so that creating one counts as a change.
+func statFiles(files []string) fileSnapshot {
+	snap := make(fileSnapshot, len(files))
+	for _, path := range files {
+		snap[path] = statFile(path)
+	}
+	return snap
+}
+
+// statFile records the current state of a file.
+func statFile(path string) fileStat {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStat{}
+	}
+	return fileStat{exists: true, size: info.Size(), modTime: info.ModTime()}
+}
+
+func (s fileSnapshot) equal(other fileSnapshot) bool {
+	if len(s) != len(other) {
+		return false
+	}
+	for path, st := range s {
+		o, ok := other[path]
+		if !ok || o.exists != st.exists || o.size != st.size || !o.modTime.Equal(st.modTime) {
+			return false
+		}
+	}
+	return true
+}
+
+// mergeFiles returns the sorted union of a and b.
+func mergeFiles(a, b []string) []string {
+	seen := make(map[string]bool, len(a)+len(b))
+	var merged []string
+	for _, list := range [][]string{a, b} {
+		for _, path := range list {
+			if !seen[path] {
+				seen[path] = true
+				merged = append(merged, path)
+			}
+		}
+	}
+	sort.Strings(merged)
+	return merged
+}
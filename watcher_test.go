@@ -0,0 +1,217 @@
+package hclconfig
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+type watchChange struct {
+	old, new *SimpleConfig
+	err      error
+}
+
+func newTestWatcher(t *testing.T, filename string) (*Watcher[SimpleConfig], chan watchChange) {
+	t.Helper()
+	changes := make(chan watchChange, 10)
+	w, err := NewWatcher(filename, func(old, new *SimpleConfig, err error) {
+		changes <- watchChange{old, new, err}
+	}, WatchInterval(5*time.Millisecond), WatchDebounce(20*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { w.Close() })
+	return w, changes
+}
+
+func waitForChange(t *testing.T, changes chan watchChange) watchChange {
+	t.Helper()
+	select {
+	case c := <-changes:
+		return c
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for reload")
+		return watchChange{}
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWatcher_ReloadsOnChange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.hcl")
+	writeFile(t, path, `database {
+  host = "localhost"
+  port = 5432
+}
+`)
+	w, changes := newTestWatcher(t, path)
+	if got := w.Current().Database.Host; got != "localhost" {
+		t.Fatalf("host = %q, want %q", got, "localhost")
+	}
+
+	writeFile(t, path, `database {
+  host = "db.example.com"
+  port = 5432
+}
+`)
+	c := waitForChange(t, changes)
+	if c.err != nil {
+		t.Fatal(c.err)
+	}
+	if c.old.Database.Host != "localhost" || c.new.Database.Host != "db.example.com" {
+		t.Errorf("change = %q -> %q", c.old.Database.Host, c.new.Database.Host)
+	}
+	if w.Current() != c.new {
+		t.Error("Current() should return the new value")
+	}
+}
+
+func TestWatcher_KeepsCurrentOnError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.hcl")
+	writeFile(t, path, `database {
+  host = "localhost"
+  port = 5432
+}
+`)
+	w, changes := newTestWatcher(t, path)
+	before := w.Current()
+
+	writeFile(t, path, `database {
+  host = undefined_var
+  port = 5432
+}
+`)
+	c := waitForChange(t, changes)
+	if c.err == nil {
+		t.Fatal("expected load error")
+	}
+	if c.new != nil || c.old != before {
+		t.Errorf("expected old value and nil new value, got %v, %v", c.old, c.new)
+	}
+	if w.Current() != before {
+		t.Error("Current() should keep the last good value")
+	}
+
+	writeFile(t, path, `database {
+  host = "fixed"
+  port = 5432
+}
+`)
+	c = waitForChange(t, changes)
+	if c.err != nil {
+		t.Fatal(c.err)
+	}
+	if got := w.Current().Database.Host; got != "fixed" {
+		t.Errorf("host = %q, want %q", got, "fixed")
+	}
+}
+
+func TestWatcher_TracksFileFunctionInputs(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.hcl")
+	hostPath := filepath.Join(dir, "host.txt")
+	writeFile(t, hostPath, "localhost")
+	writeFile(t, path, `database {
+  host = trimspace(file("host.txt"))
+  port = 5432
+}
+`)
+	w, changes := newTestWatcher(t, path)
+
+	writeFile(t, hostPath, "db.internal.example.com")
+	c := waitForChange(t, changes)
+	if c.err != nil {
+		t.Fatal(c.err)
+	}
+	if got := w.Current().Database.Host; got != "db.internal.example.com" {
+		t.Errorf("host = %q, want %q", got, "db.internal.example.com")
+	}
+}
+
+func TestNewWatcher_InitialLoadError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.hcl")
+	writeFile(t, path, `database {
+  host = undefined_var
+  port = 5432
+}
+`)
+	_, err := NewWatcher[SimpleConfig](path, nil)
+	if err == nil {
+		t.Fatal("expected error from initial load")
+	}
+	if !strings.Contains(err.Error(), "undefined_var") {
+		t.Errorf("expected error naming undefined_var, got: %v", err)
+	}
+}
+
+func TestNewWatcher_RejectsNonPositiveTimings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.hcl")
+	writeFile(t, path, `database {
+  host = "localhost"
+  port = 5432
+}
+`)
+	for _, opt := range []WatchOption{WatchInterval(0), WatchInterval(-time.Second), WatchDebounce(0)} {
+		w, err := NewWatcher[SimpleConfig](path, nil, opt)
+		if err == nil {
+			w.Close()
+			t.Fatal("expected error for non-positive timing")
+		}
+		if !strings.Contains(err.Error(), "must be positive") {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+}
+
+func TestWatcher_ReloadsAfterWriteDuringLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.hcl")
+	config := func(port int) string {
+		return fmt.Sprintf("database {\n  host = during_load()\n  port = %d\n}\n", port)
+	}
+	writeFile(t, path, config(1))
+
+	// Once armed, the next load rewrites the file after reading it, as an
+	// editor saving again mid-load would.
+	var armed atomic.Bool
+	ctx := &hcl.EvalContext{Functions: map[string]function.Function{
+		"during_load": function.New(&function.Spec{
+			Type: function.StaticReturnType(cty.String),
+			Impl: func([]cty.Value, cty.Type) (cty.Value, error) {
+				if armed.CompareAndSwap(true, false) {
+					writeFile(t, path, config(333))
+				}
+				return cty.StringVal("localhost"), nil
+			},
+		}),
+	}}
+	changes := make(chan watchChange, 10)
+	w, err := NewWatcher(path, func(old, new *SimpleConfig, err error) {
+		changes <- watchChange{old, new, err}
+	}, WatchInterval(5*time.Millisecond), WatchDebounce(20*time.Millisecond), WatchLoadOptions(WithEvalContext(ctx)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	armed.Store(true)
+	writeFile(t, path, config(22))
+	if c := waitForChange(t, changes); c.err != nil || c.new.Database.Port != 22 {
+		t.Fatalf("first reload = %+v, %v", c.new, c.err)
+	}
+	if c := waitForChange(t, changes); c.err != nil || c.new.Database.Port != 333 {
+		t.Fatalf("second reload = %+v, %v", c.new, c.err)
+	}
+}